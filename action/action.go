@@ -1,9 +1,74 @@
 package action
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/dreamlibrarian/solaredge-monitoring/client"
+	"github.com/rs/zerolog/log"
 )
 
 type Action struct {
 	client *client.Client
 }
+
+// DiscoverSiteIDs lists every site the API key can see.
+func (a *Action) DiscoverSiteIDs() ([]string, error) {
+	log.Debug().Msg("Getting sites from upstream.")
+	siteList, err := a.client.GetSiteList()
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Interface("sites", siteList).Msg("got sites")
+
+	siteIDs := make([]string, 0, len(siteList))
+	for _, site := range siteList {
+		siteIDs = append(siteIDs, strconv.FormatInt(site.ID, 10))
+	}
+	return siteIDs, nil
+}
+
+// DiscoverEquipment lists the serials of everything in a site's inventory: inverters, gateways,
+// batteries, meters and third-party inverters.
+func (a *Action) DiscoverEquipment(siteID string) ([]string, error) {
+	inventory, err := a.client.GetSiteInventory(siteID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get inventory for site %s: %w", siteID, err)
+	}
+	log.Debug().Interface("inventory", inventory).Msg("got inventory")
+
+	var serials []string
+	for _, inverter := range inventory.Inverters {
+		serials = append(serials, inverter.SerialNumber)
+	}
+	for _, gateway := range inventory.Gateways {
+		serials = append(serials, gateway.SerialNumber)
+	}
+	for _, battery := range inventory.Batteries {
+		serials = append(serials, battery.SerialNumber)
+	}
+	for _, meter := range inventory.Meters {
+		serials = append(serials, meter.SerialNumber)
+	}
+	for _, inverter := range inventory.ThirdPartyInverters {
+		serials = append(serials, inverter.SerialNumber)
+	}
+	return serials, nil
+}
+
+// DiscoverInverters lists the serials of a site's inverters, for the unattended collectors. The
+// equipment data endpoint only knows SolarEdge inverters; asking it about gateways, meters or
+// batteries fails the whole run, so the checkpointed runs leave them out.
+func (a *Action) DiscoverInverters(siteID string) ([]string, error) {
+	inventory, err := a.client.GetSiteInventory(siteID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get inventory for site %s: %w", siteID, err)
+	}
+	log.Debug().Interface("inventory", inventory).Msg("got inventory")
+
+	serials := make([]string, 0, len(inventory.Inverters))
+	for _, inverter := range inventory.Inverters {
+		serials = append(serials, inverter.SerialNumber)
+	}
+	return serials, nil
+}
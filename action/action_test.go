@@ -0,0 +1,38 @@
+package action
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/client"
+	"github.com/stretchr/testify/assert"
+)
+
+const fullInventory = `{"Inventory":{
+	"inverters":[{"name":"Inverter 1","SN":"7E1234AB-12"}],
+	"gateways":[{"name":"Gateway 1","serialNumber":"GW-1"}],
+	"batteries":[{"name":"Battery 1","serialNumber":"BAT-1"}],
+	"meters":[{"name":"Meter 1","SN":"MTR-1"}],
+	"thirdPartyInverters":[{"name":"Other Inverter","SN":"TPI-1"}]
+}}`
+
+func TestDiscover(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(fullInventory))
+	}))
+	defer server.Close()
+
+	action := NewTelemetryAction("secret-key", client.WithBaseURL(server.URL))
+
+	equipment, err := action.DiscoverEquipment("12345")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"7E1234AB-12", "GW-1", "BAT-1", "MTR-1", "TPI-1"}, equipment, "--all-equipment should find everything in the inventory")
+	}
+
+	inverters, err := action.DiscoverInverters("12345")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"7E1234AB-12"}, inverters)
+	}
+}
@@ -2,7 +2,6 @@ package action
 
 import (
 	"errors"
-	"strconv"
 	"time"
 
 	"github.com/dreamlibrarian/solaredge-monitoring/api"
@@ -23,43 +22,54 @@ type EnergyConfig struct {
 	SiteIDs       []string
 }
 
-func NewEnergyAction(key string) *EnergyAction {
+func NewEnergyAction(key string, opts ...client.Option) *EnergyAction {
 	return &EnergyAction{
 		Action{
-			client: client.NewClient(key),
+			client: client.NewClient(key, opts...),
 		},
 	}
 }
 
+// Do fetches energy for every site, keyed by site ID.
 func (a *EnergyAction) Do(config *EnergyConfig) (map[string]*api.Energy, error) {
-
 	siteIDContentMap := make(map[string]*api.Energy)
 
+	err := a.Stream(config, func(siteID string, energy *api.Energy) error {
+		siteIDContentMap[siteID] = energy
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return siteIDContentMap, nil
+}
+
+// Stream hands each site's energy to f as soon as it's fetched; an error from f stops it.
+func (a *EnergyAction) Stream(config *EnergyConfig, f func(siteID string, energy *api.Energy) error) error {
 	log.Debug().Msg("Getting Energy readings")
 	if config.DiscoverSites {
 		if len(config.SiteIDs) > 0 {
-			return nil, errors.New("cannot set all-sites and specify site-ids")
+			return errors.New("cannot set all-sites and specify site-ids")
 		}
-		log.Debug().Msg("Getting sites from upstream.")
-		siteList, err := a.client.GetSiteList()
+		siteIDs, err := a.DiscoverSiteIDs()
 		if err != nil {
-			return nil, err
-		}
-		log.Debug().Interface("sites", siteList).Msg("got sites")
-		for _, site := range siteList {
-			config.SiteIDs = append(config.SiteIDs, strconv.FormatInt(site.ID, 10))
+			return err
 		}
+		config.SiteIDs = siteIDs
 	} else if len(config.SiteIDs) == 0 {
-		return nil, errors.New("must have at least one site configured, or choose site discovery")
+		return errors.New("must have at least one site configured, or choose site discovery")
 	}
 
 	for _, siteID := range config.SiteIDs {
 		usage, err := a.client.GetEnergyUsage(siteID, config.TimeUnit, config.StartTime, config.EndTime)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		siteIDContentMap[siteID] = usage
+		err = f(siteID, usage)
+		if err != nil {
+			return err
+		}
 	}
-	return siteIDContentMap, nil
+	return nil
 }
@@ -0,0 +1,214 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/checkpoint"
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog/log"
+)
+
+// IncrementalConfig is for runs that pick up where the last one stopped, per site for energy and
+// per inverter for telemetry, so one that fails doesn't hold the others back.
+type IncrementalConfig struct {
+	TimeUnit string
+	// StartTime is where anything without a checkpoint starts.
+	StartTime time.Time
+	EndTime   time.Time
+	// Backfill starts everything from StartTime, checkpoint or not. Checkpoints still only move
+	// forward.
+	Backfill bool
+	// FromInstallation starts anything without a checkpoint at its site's installation date, as
+	// sync does, rather than StartTime; sites without one still start at StartTime.
+	FromInstallation bool
+	// Legacy is how far the single checkpoint the collector used to keep for every site had got.
+	// Energy for a site without a checkpoint of its own starts there instead, unless the site was
+	// installed since; the first advance seeds the site's own checkpoint from it.
+	Legacy time.Time
+
+	DiscoverSites bool
+	SiteIDs       []string
+	// SerialNumbers limits telemetry to these inverters, rather than every one at each site.
+	SerialNumbers []string
+}
+
+func (config *IncrementalConfig) siteIDs(a *Action) ([]string, error) {
+	if config.DiscoverSites {
+		if len(config.SiteIDs) > 0 {
+			return nil, errors.New("cannot set all-sites and specify site-ids")
+		}
+		return a.DiscoverSiteIDs()
+	} else if len(config.SiteIDs) == 0 {
+		return nil, errors.New("must set all-sites or specify at least one site-id")
+	}
+	return config.SiteIDs, nil
+}
+
+// firstStart is where key starts when it has no checkpoint yet.
+func (config *IncrementalConfig) firstStart(a *Action, key checkpoint.Key) (time.Time, error) {
+	var installed time.Time
+	if config.FromInstallation {
+		details, err := a.client.GetSiteDetails(key.SiteID)
+		if err != nil {
+			return time.Time{}, err
+		}
+		installed = details.InstallationDate.Time
+		if installed.IsZero() {
+			log.Warn().Str("siteid", key.SiteID).Msg("site has no installation date, starting from the window instead")
+		}
+	}
+
+	switch {
+	case key.Action == checkpoint.ActionEnergy && !config.Legacy.IsZero() && config.Legacy.After(installed):
+		return config.Legacy, nil
+	case !installed.IsZero():
+		return installed, nil
+	}
+	return config.StartTime, nil
+}
+
+// resume fetches key's data from its checkpoint to the end, in windows the API will accept, and
+// moves the checkpoint to the latest data fetch hands back after each one.
+func resume(a *Action, config *IncrementalConfig, store checkpoint.Store, key checkpoint.Key, maxWindow time.Duration, fetch func(from, to time.Time) (time.Time, error)) error {
+	last, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+
+	start := config.StartTime
+	if !config.Backfill {
+		if !last.IsZero() {
+			start = last
+		} else if start, err = config.firstStart(a, key); err != nil {
+			return err
+		}
+	}
+
+	for from := start; from.Before(config.EndTime); {
+		to := from.Add(maxWindow)
+		if to.After(config.EndTime) {
+			to = config.EndTime
+		}
+
+		latest, err := fetch(from, to)
+		if err != nil {
+			return err
+		}
+		if latest.After(last) {
+			err = store.Advance(key, last, latest)
+			if errors.Is(err, checkpoint.ErrConflict) {
+				// another run has got to this key too, most likely a redelivered message; what we
+				// fetched is theirs as well, so they can carry on from here.
+				log.Warn().Err(err).Str("checkpoint", key.String()).Msg("checkpoint moved by another run, leaving it to them")
+				return nil
+			} else if err != nil {
+				return err
+			}
+			last = latest
+		}
+		from = to
+	}
+	return nil
+}
+
+// Incremental hands each site's new energy to f, then moves the site's checkpoint past it. A site
+// that fails is logged and reported once the rest have had their turn.
+func (a *EnergyAction) Incremental(config *IncrementalConfig, store checkpoint.Store, f func(siteID string, energy *api.Energy) error) error {
+	siteIDs, err := config.siteIDs(&a.Action)
+	if err != nil {
+		return err
+	}
+
+	maxWindow := maxSubDayWindow
+	if config.TimeUnit == api.TimeUnitDay {
+		maxWindow = maxDayWindow
+	}
+
+	var errs error
+	for _, siteID := range siteIDs {
+		key := checkpoint.Key{Action: checkpoint.ActionEnergy, SiteID: siteID}
+		err := resume(&a.Action, config, store, key, maxWindow, func(from, to time.Time) (time.Time, error) {
+			energy, err := a.client.GetEnergyUsage(siteID, config.TimeUnit, from, to)
+			if err != nil {
+				return time.Time{}, err
+			}
+			latest := LatestEnergy(energy)
+			if latest.IsZero() {
+				return latest, nil
+			}
+			return latest, f(siteID, energy)
+		})
+		if err != nil {
+			log.Error().Err(err).Str("siteid", siteID).Msg("unable to collect energy")
+			errs = multierror.Append(errs, fmt.Errorf("site %s: %w", siteID, err))
+		}
+	}
+	return errs
+}
+
+// Incremental hands each inverter's new telemetry to f, then moves the inverter's checkpoint past
+// it. Like energy, a site or inverter that fails doesn't stop the rest.
+func (t *TelemetryAction) Incremental(config *IncrementalConfig, store checkpoint.Store, f func(siteID, serial string, telemetries []api.Telemetry) error) error {
+	siteIDs, err := config.siteIDs(&t.Action)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, siteID := range siteIDs {
+		serials := config.SerialNumbers
+		if len(serials) == 0 {
+			serials, err = t.DiscoverInverters(siteID)
+			if err != nil {
+				log.Error().Err(err).Str("siteid", siteID).Msg("unable to find inverters")
+				errs = multierror.Append(errs, fmt.Errorf("site %s: %w", siteID, err))
+				continue
+			}
+		}
+
+		for _, serial := range serials {
+			key := checkpoint.Key{Action: checkpoint.ActionTelemetry, SiteID: siteID, Serial: serial}
+			err := resume(&t.Action, config, store, key, maxTelemetryWindow, func(from, to time.Time) (time.Time, error) {
+				telemetries, err := t.client.GetTelemetryForEquipment(siteID, serial, config.TimeUnit, from, to)
+				if err != nil {
+					return time.Time{}, err
+				}
+				latest := LatestTelemetry(telemetries)
+				if latest.IsZero() {
+					return latest, nil
+				}
+				return latest, f(siteID, serial, telemetries)
+			})
+			if err != nil {
+				log.Error().Err(err).Str("siteid", siteID).Str("serial", serial).Msg("unable to collect telemetry")
+				errs = multierror.Append(errs, fmt.Errorf("site %s, inverter %s: %w", siteID, serial, err))
+			}
+		}
+	}
+	return errs
+}
+
+// LatestEnergy is the time of the last period with a value; the API lists the rest of today with
+// nulls.
+func LatestEnergy(energy *api.Energy) time.Time {
+	var result time.Time
+	for _, v := range energy.Values {
+		if v.Value != nil && v.Date.After(result) {
+			result = v.Date.Time
+		}
+	}
+	return result
+}
+
+func LatestTelemetry(telemetries []api.Telemetry) time.Time {
+	var result time.Time
+	for _, t := range telemetries {
+		if t.Date.After(result) {
+			result = t.Date.Time
+		}
+	}
+	return result
+}
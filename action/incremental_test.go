@@ -0,0 +1,156 @@
+package action
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/checkpoint"
+	"github.com/dreamlibrarian/solaredge-monitoring/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncremental(t *testing.T) {
+	var energyStarts, telemetryStarts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		start := r.URL.Query().Get("startTime")
+		switch {
+		case strings.Contains(r.URL.Path, "/99999/"):
+			http.Error(w, "site is broken", http.StatusInternalServerError)
+		case strings.HasSuffix(r.URL.Path, "/details"):
+			w.Write([]byte(`{"details":{"id":12345,"name":"Home","location":{"timeZone":"UTC"}}}`))
+		case strings.HasSuffix(r.URL.Path, "/inventory"):
+			w.Write([]byte(`{"Inventory":{"inverters":[{"name":"Inverter 1","SN":"7E1234AB-12"}]}}`))
+		case strings.HasSuffix(r.URL.Path, "/energy"):
+			energyStarts = append(energyStarts, start)
+			fmt.Fprintf(w, `{"energy":{"timeUnit":"HOUR","unit":"Wh","values":[{"date":%q,"value":100},{"date":"2021-12-31 23:00:00"}]}}`, start)
+		case strings.HasSuffix(r.URL.Path, "/data"):
+			telemetryStarts = append(telemetryStarts, start)
+			fmt.Fprintf(w, `{"data":{"count":1,"telemetries":[{"date":%q,"totalActivePower":1500}]}}`, start)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store := checkpoint.NewMemoryStore()
+	config := &IncrementalConfig{
+		TimeUnit:  api.TimeUnitHour,
+		StartTime: time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2021, 11, 2, 0, 0, 0, 0, time.UTC),
+		SiteIDs:   []string{"99999", "12345"},
+	}
+
+	energy := NewEnergyAction("secret-key", client.WithBaseURL(server.URL))
+	var sites []string
+	err := energy.Incremental(config, store, func(siteID string, energy *api.Energy) error {
+		sites = append(sites, siteID)
+		return nil
+	})
+	if assert.Error(t, err, "the broken site should be reported") {
+		assert.Contains(t, err.Error(), "site 99999")
+	}
+	assert.Equal(t, []string{"12345"}, sites, "the broken site shouldn't hold the other back")
+	assert.Equal(t, []string{"2021-11-01 00:00:00"}, energyStarts)
+
+	last, err := store.Get(checkpoint.Key{Action: checkpoint.ActionEnergy, SiteID: "12345"})
+	assert.NoError(t, err)
+	assert.True(t, config.StartTime.Equal(last), "periods without values shouldn't move the checkpoint")
+
+	config.SiteIDs = []string{"12345"}
+	config.StartTime = time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	config.EndTime = time.Date(2021, 11, 3, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, energy.Incremental(config, store, func(string, *api.Energy) error { return nil }))
+	assert.Equal(t, "2021-11-01 00:00:00", energyStarts[1], "the second run should pick up from the checkpoint")
+
+	// a redelivered message racing the first shouldn't fail once the other run has moved on.
+	racing := &racingStore{Store: store}
+	config.EndTime = time.Date(2021, 11, 4, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, energy.Incremental(config, racing, func(string, *api.Energy) error {
+		racing.race = true
+		return nil
+	}))
+
+	telemetry := NewTelemetryAction("secret-key", client.WithBaseURL(server.URL))
+	config.EndTime = config.StartTime.Add(10 * 24 * time.Hour)
+	var serials []string
+	err = telemetry.Incremental(config, store, func(siteID, serial string, telemetries []api.Telemetry) error {
+		serials = append(serials, serial)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2021-10-01 00:00:00", "2021-10-08 00:00:00"}, telemetryStarts, "long gaps should be fetched a week at a time")
+	assert.Equal(t, []string{"7E1234AB-12", "7E1234AB-12"}, serials)
+
+	last, err = store.Get(checkpoint.Key{Action: checkpoint.ActionTelemetry, SiteID: "12345", Serial: "7E1234AB-12"})
+	assert.NoError(t, err)
+	assert.True(t, time.Date(2021, 10, 8, 0, 0, 0, 0, time.UTC).Equal(last))
+}
+
+// racingStore moves a checkpoint underneath Advance once race is set, like another run would.
+type racingStore struct {
+	checkpoint.Store
+	race bool
+}
+
+func (r *racingStore) Advance(k checkpoint.Key, previous, t time.Time) error {
+	if r.race {
+		r.race = false
+		if err := r.Store.Set(k, t.Add(time.Hour)); err != nil {
+			return err
+		}
+	}
+	return r.Store.Advance(k, previous, t)
+}
+
+func TestIncrementalFirstStart(t *testing.T) {
+	var energyStarts, telemetryStarts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		start := r.URL.Query().Get("startTime")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/11111/details"):
+			w.Write([]byte(`{"details":{"id":11111,"name":"Old","installationDate":"2021-08-19","location":{"timeZone":"UTC"}}}`))
+		case strings.HasSuffix(r.URL.Path, "/22222/details"):
+			w.Write([]byte(`{"details":{"id":22222,"name":"New","installationDate":"2021-10-20","location":{"timeZone":"UTC"}}}`))
+		case strings.HasSuffix(r.URL.Path, "/inventory"):
+			w.Write([]byte(`{"Inventory":{"inverters":[{"name":"Inverter 1","SN":"7E1234AB-12"}]}}`))
+		case strings.HasSuffix(r.URL.Path, "/energy"):
+			energyStarts = append(energyStarts, start)
+			w.Write([]byte(`{"energy":{"timeUnit":"HOUR","unit":"Wh","values":[]}}`))
+		case strings.HasSuffix(r.URL.Path, "/data"):
+			telemetryStarts = append(telemetryStarts, start)
+			w.Write([]byte(`{"data":{"count":0,"telemetries":[]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	config := &IncrementalConfig{
+		TimeUnit:         api.TimeUnitHour,
+		StartTime:        time.Date(2021, 10, 31, 0, 0, 0, 0, time.UTC),
+		EndTime:          time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC),
+		FromInstallation: true,
+		Legacy:           time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC),
+		SiteIDs:          []string{"11111", "22222"},
+	}
+
+	energy := NewEnergyAction("secret-key", client.WithBaseURL(server.URL))
+	assert.NoError(t, energy.Incremental(config, checkpoint.NewMemoryStore(), func(string, *api.Energy) error { return nil }))
+	if assert.NotEmpty(t, energyStarts) {
+		assert.Equal(t, "2021-10-01 00:00:00", energyStarts[0], "a site the old collector had reached should carry on from the legacy checkpoint")
+		assert.Contains(t, energyStarts, "2021-10-20 00:00:00", "a site installed since should start at installation")
+	}
+
+	telemetry := NewTelemetryAction("secret-key", client.WithBaseURL(server.URL))
+	config.SiteIDs = []string{"11111"}
+	config.EndTime = time.Date(2021, 8, 20, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, telemetry.Incremental(config, checkpoint.NewMemoryStore(), func(string, string, []api.Telemetry) error { return nil }))
+	assert.Equal(t, []string{"2021-08-19 00:00:00"}, telemetryStarts, "the legacy checkpoint was only ever for energy")
+}
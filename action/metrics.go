@@ -0,0 +1,161 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/client"
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog/log"
+)
+
+// telemetryLookback is how far back we look for an inverter's latest reading; inverters report
+// every five minutes or so, but uploads can lag.
+const telemetryLookback = 2 * time.Hour
+
+type MetricsAction struct {
+	Action
+}
+
+type MetricsConfig struct {
+	DiscoverSites bool
+	SiteIDs       []string
+
+	// Now is when "today" is judged from; it defaults to the current time.
+	Now time.Time
+
+	// PowerFlow fetches the site's current power flow too, for battery state; it's one more request.
+	PowerFlow bool
+}
+
+// SiteSnapshot is the current state of a site, as much of it as we could get.
+type SiteSnapshot struct {
+	SiteID string
+	// TodayEnergy is in Wh, nil when the API hasn't reported anything yet today.
+	TodayEnergy *float64
+	// Inverters holds the latest telemetry reading per inverter serial.
+	Inverters map[string]*api.Telemetry
+	// PowerFlow is only fetched when asked for.
+	PowerFlow *api.PowerFlow
+	// Requests is how many API calls it took to build the snapshot.
+	Requests int
+}
+
+func NewMetricsAction(key string, opts ...client.Option) *MetricsAction {
+	return &MetricsAction{
+		Action: Action{
+			client: client.NewClient(key, opts...),
+		},
+	}
+}
+
+// Do snapshots every site it can. A site that fails is left out and reported in the error, so the
+// rest still come back; callers should use whatever snapshots they get, error or not.
+func (m *MetricsAction) Do(config *MetricsConfig) (map[string]*SiteSnapshot, error) {
+	now := config.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	siteIDs := config.SiteIDs
+	var listRequests int
+	if config.DiscoverSites {
+		if len(siteIDs) > 0 {
+			return nil, errors.New("cannot set all-sites and specify site-ids")
+		}
+		siteList, err := m.client.GetSiteList()
+		if err != nil {
+			return nil, err
+		}
+		listRequests++
+		for _, site := range siteList {
+			siteIDs = append(siteIDs, strconv.FormatInt(site.ID, 10))
+		}
+	} else if len(siteIDs) == 0 {
+		return nil, errors.New("must set all-sites or specify at least one site-id")
+	}
+
+	result := make(map[string]*SiteSnapshot)
+	var errs error
+	for _, siteID := range siteIDs {
+		snapshot, err := m.snapshot(siteID, now, config.PowerFlow)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("site %s: %w", siteID, err))
+			continue
+		}
+		// the site list is fetched every refresh too, so it's paced for like the site's own requests.
+		snapshot.Requests += listRequests
+		result[siteID] = snapshot
+	}
+
+	return result, errs
+}
+
+func (m *MetricsAction) snapshot(siteID string, now time.Time, powerFlow bool) (*SiteSnapshot, error) {
+	snapshot := &SiteSnapshot{
+		SiteID:    siteID,
+		Inverters: make(map[string]*api.Telemetry),
+	}
+
+	loc, err := m.client.SiteLocation(siteID)
+	if err != nil {
+		return nil, err
+	}
+	localNow := now.In(loc)
+	year, month, day := localNow.Date()
+	startOfToday := time.Date(year, month, day, 0, 0, 0, 0, loc)
+
+	energy, err := m.client.GetEnergyUsage(siteID, api.TimeUnitDay, startOfToday, localNow)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Requests++
+	for _, v := range energy.Values {
+		if v.Value != nil {
+			today := float64(*v.Value)
+			snapshot.TodayEnergy = &today
+		}
+	}
+
+	inventory, err := m.client.GetSiteInventory(siteID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Requests++
+
+	for _, inverter := range inventory.Inverters {
+		sn := inverter.SerialNumber
+		log := log.With().Str("siteid", siteID).Str("serial", sn).Logger()
+
+		telemetries, err := m.client.GetTelemetryForEquipment(siteID, sn, api.TimeUnitQuarterHour, now.Add(-telemetryLookback), now)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get telemetry for serial %s: %w", sn, err)
+		}
+		snapshot.Requests++
+
+		var latest *api.Telemetry
+		for i := range telemetries {
+			if latest == nil || telemetries[i].Date.After(latest.Date.Time) {
+				latest = &telemetries[i]
+			}
+		}
+		if latest == nil {
+			log.Debug().Msg("no recent telemetry for inverter")
+			continue
+		}
+		snapshot.Inverters[sn] = latest
+	}
+
+	if powerFlow {
+		snapshot.PowerFlow, err = m.client.GetCurrentPowerFlow(siteID)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Requests++
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,47 @@
+package action
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsSiteFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/sites/list"):
+			w.Write([]byte(`{"sites":{"count":2,"site":[{"id":99999,"location":{"timeZone":"UTC"}},{"id":12345,"location":{"timeZone":"UTC"}}]}}`))
+		case strings.Contains(r.URL.Path, "/99999/"):
+			http.Error(w, "site is broken", http.StatusInternalServerError)
+		case strings.HasSuffix(r.URL.Path, "/details"):
+			w.Write([]byte(`{"details":{"id":12345,"name":"Home","location":{"timeZone":"UTC"}}}`))
+		case strings.HasSuffix(r.URL.Path, "/energy"):
+			w.Write([]byte(`{"energy":{"timeUnit":"DAY","unit":"Wh","values":[{"date":"2021-11-02 00:00:00","value":1234}]}}`))
+		case strings.HasSuffix(r.URL.Path, "/inventory"):
+			w.Write([]byte(`{"Inventory":{"inverters":[]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	metrics := NewMetricsAction("secret-key", client.WithBaseURL(server.URL))
+	snapshots, err := metrics.Do(&MetricsConfig{
+		DiscoverSites: true,
+		Now:           time.Date(2021, 11, 2, 12, 0, 0, 0, time.UTC),
+	})
+	if assert.Error(t, err, "the broken site should be reported") {
+		assert.Contains(t, err.Error(), "site 99999")
+	}
+	if assert.Contains(t, snapshots, "12345", "the broken site shouldn't hold the other back") {
+		assert.Equal(t, 1234.0, *snapshots["12345"].TodayEnergy)
+		assert.Equal(t, 3, snapshots["12345"].Requests, "energy, inventory and the site list should all be counted")
+	}
+	assert.NotContains(t, snapshots, "99999")
+}
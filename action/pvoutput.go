@@ -0,0 +1,148 @@
+package action
+
+import (
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/client"
+)
+
+// the monitoring API gives a month of power details at a time.
+const maxPowerDetailsWindow = 28 * 24 * time.Hour
+
+type PVOutputAction struct {
+	Action
+}
+
+type PVOutputConfig struct {
+	SiteID string
+	// StartTime is moved back to the site-local midnight before it, since PVOutput wants energy
+	// accumulated over the day.
+	StartTime time.Time
+	// EndTime defaults to now.
+	EndTime time.Time
+
+	SkipTelemetry bool
+}
+
+// PVOutputData is everything an upload is built from, in the site's zone.
+type PVOutputData struct {
+	Location *time.Location
+	// Energy is in quarter hours.
+	Energy *api.Energy
+	Power  *api.PowerDetails
+	// Telemetry is keyed by inverter serial, empty with SkipTelemetry.
+	Telemetry map[string][]api.Telemetry
+}
+
+func NewPVOutputAction(key string, opts ...client.Option) *PVOutputAction {
+	return &PVOutputAction{
+		Action: Action{
+			client: client.NewClient(key, opts...),
+		},
+	}
+}
+
+func (p *PVOutputAction) Do(config *PVOutputConfig) (*PVOutputData, error) {
+	loc, err := p.client.SiteLocation(config.SiteID)
+	if err != nil {
+		return nil, err
+	}
+
+	end := config.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	year, month, day := config.StartTime.In(loc).Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+
+	data := &PVOutputData{
+		Location:  loc,
+		Energy:    &api.Energy{},
+		Power:     &api.PowerDetails{},
+		Telemetry: make(map[string][]api.Telemetry),
+	}
+
+	// windows share their boundary, so anything at or before what we already have is dropped.
+	err = eachWindow(start, end, maxSubDayWindow, func(from, to time.Time) error {
+		energy, err := p.client.GetEnergyUsage(config.SiteID, api.TimeUnitQuarterHour, from, to)
+		if err != nil {
+			return err
+		}
+		data.Energy.TimeUnit, data.Energy.Unit, data.Energy.MeasuredBy = energy.TimeUnit, energy.Unit, energy.MeasuredBy
+		for _, v := range energy.Values {
+			if n := len(data.Energy.Values); n == 0 || v.Date.After(data.Energy.Values[n-1].Date.Time) {
+				data.Energy.Values = append(data.Energy.Values, v)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachWindow(start, end, maxPowerDetailsWindow, func(from, to time.Time) error {
+		power, err := p.client.GetPowerDetails(config.SiteID, from, to, api.MeterProduction, api.MeterConsumption)
+		if err != nil {
+			return err
+		}
+		data.Power.TimeUnit, data.Power.Unit = power.TimeUnit, power.Unit
+		for _, meter := range power.Meters {
+			existing := data.Power.Meter(meter.Type)
+			if existing == nil {
+				data.Power.Meters = append(data.Power.Meters, api.PowerMeter{Type: meter.Type})
+				existing = &data.Power.Meters[len(data.Power.Meters)-1]
+			}
+			for _, v := range meter.Values {
+				if n := len(existing.Values); n == 0 || v.Date.After(existing.Values[n-1].Date.Time) {
+					existing.Values = append(existing.Values, v)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if config.SkipTelemetry {
+		return data, nil
+	}
+
+	inventory, err := p.client.GetSiteInventory(config.SiteID)
+	if err != nil {
+		return nil, err
+	}
+	for _, inverter := range inventory.Inverters {
+		serial := inverter.SerialNumber
+		err = eachWindow(start, end, maxTelemetryWindow, func(from, to time.Time) error {
+			telemetries, err := p.client.GetTelemetryForEquipment(config.SiteID, serial, api.TimeUnitQuarterHour, from, to)
+			if err != nil {
+				return err
+			}
+			data.Telemetry[serial] = append(data.Telemetry[serial], telemetries...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// eachWindow calls f for consecutive windows no longer than maxWindow covering start to end.
+func eachWindow(start, end time.Time, maxWindow time.Duration, f func(from, to time.Time) error) error {
+	for from := start; from.Before(end); {
+		to := from.Add(maxWindow)
+		if to.After(end) {
+			to = end
+		}
+		err := f(from, to)
+		if err != nil {
+			return err
+		}
+		from = to
+	}
+	return nil
+}
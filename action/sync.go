@@ -0,0 +1,210 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/client"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DatasetEnergy    = "energy"
+	DatasetTelemetry = "telemetry"
+
+	// the monitoring API refuses windows longer than these.
+	maxDayWindow       = 365 * 24 * time.Hour
+	maxSubDayWindow    = 28 * 24 * time.Hour
+	maxTelemetryWindow = 7 * 24 * time.Hour
+)
+
+// SyncStore is somewhere SyncAction can keep an archive, and remember how far it got.
+type SyncStore interface {
+	// SyncedUntil is where the last sync of a dataset stopped; zero if it's never been synced.
+	// Serial is empty for site-wide datasets like energy.
+	SyncedUntil(dataset, siteID, serial, timeUnit string) (time.Time, error)
+	SetSyncedUntil(dataset, siteID, serial, timeUnit string, until time.Time) error
+
+	PutSite(site *api.SiteDetails) error
+	PutInventory(siteID string, fetchedAt time.Time, inventory *api.Inventory) error
+	PutEnergy(siteID string, energy *api.Energy) error
+	PutTelemetry(siteID, serial string, telemetries []api.Telemetry) error
+}
+
+type SyncAction struct {
+	Action
+}
+
+type SyncConfig struct {
+	// StartTime bounds how far back the first sync of a site goes; zero means its installation date.
+	StartTime time.Time
+	// EndTime defaults to now.
+	EndTime  time.Time
+	TimeUnit string
+
+	DiscoverSites bool
+	SiteIDs       []string
+
+	SkipTelemetry bool
+}
+
+func NewSyncAction(key string, opts ...client.Option) *SyncAction {
+	return &SyncAction{
+		Action: Action{
+			client: client.NewClient(key, opts...),
+		},
+	}
+}
+
+// Do brings the store up to date, fetching only the windows it doesn't have yet. Days before today
+// are treated as final; today is fetched again on every sync, and upserted over what's there.
+func (s *SyncAction) Do(config *SyncConfig, store SyncStore) error {
+	end := config.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	siteIDs := config.SiteIDs
+	if config.DiscoverSites {
+		if len(siteIDs) > 0 {
+			return errors.New("cannot set all-sites and specify site-ids")
+		}
+		siteList, err := s.client.GetSiteList()
+		if err != nil {
+			return err
+		}
+		for _, site := range siteList {
+			siteIDs = append(siteIDs, strconv.FormatInt(site.ID, 10))
+		}
+	} else if len(siteIDs) == 0 {
+		return errors.New("must set all-sites or specify at least one site-id")
+	}
+
+	for _, siteID := range siteIDs {
+		err := s.syncSite(config, store, siteID, end)
+		if err != nil {
+			return fmt.Errorf("unable to sync site %s: %w", siteID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SyncAction) syncSite(config *SyncConfig, store SyncStore, siteID string, end time.Time) error {
+	log := log.With().Str("siteid", siteID).Logger()
+
+	details, err := s.client.GetSiteDetails(siteID)
+	if err != nil {
+		return err
+	}
+	err = store.PutSite(details)
+	if err != nil {
+		return err
+	}
+
+	loc, err := details.Location.TimeLocation()
+	if err != nil {
+		return err
+	}
+	localEnd := end.In(loc)
+	year, month, day := localEnd.Date()
+	startOfToday := time.Date(year, month, day, 0, 0, 0, 0, loc)
+
+	start := config.StartTime
+	if start.IsZero() {
+		start = details.InstallationDate.Time
+	}
+	if start.IsZero() {
+		return errors.New("site has no installation date, so a start time is needed")
+	}
+
+	inventory, err := s.client.GetSiteInventory(siteID)
+	if err != nil {
+		return err
+	}
+	err = store.PutInventory(siteID, end, inventory)
+	if err != nil {
+		return err
+	}
+
+	maxWindow := maxSubDayWindow
+	if config.TimeUnit == api.TimeUnitDay {
+		maxWindow = maxDayWindow
+	}
+	err = s.syncWindows(store, DatasetEnergy, siteID, "", config.TimeUnit, start, end, startOfToday, maxWindow,
+		func(from, to time.Time) error {
+			log.Debug().Time("from", from).Time("to", to).Msg("syncing energy")
+			energy, err := s.client.GetEnergyUsage(siteID, config.TimeUnit, from, to)
+			if err != nil {
+				return err
+			}
+			return store.PutEnergy(siteID, energy)
+		})
+	if err != nil {
+		return err
+	}
+
+	if config.SkipTelemetry {
+		return nil
+	}
+
+	for _, inverter := range inventory.Inverters {
+		serial := inverter.SerialNumber
+		err = s.syncWindows(store, DatasetTelemetry, siteID, serial, "", start, end, startOfToday, maxTelemetryWindow,
+			func(from, to time.Time) error {
+				log.Debug().Str("serial", serial).Time("from", from).Time("to", to).Msg("syncing telemetry")
+				telemetries, err := s.client.GetTelemetryForEquipment(siteID, serial, api.TimeUnitQuarterHour, from, to)
+				if err != nil {
+					return err
+				}
+				return store.PutTelemetry(siteID, serial, telemetries)
+			})
+		if err != nil {
+			return fmt.Errorf("serial %s: %w", serial, err)
+		}
+	}
+
+	return nil
+}
+
+// syncWindows walks from wherever the dataset was last synced up to end, a window at a time. The
+// checkpoint never moves past final, so anything after it is fetched again next time.
+func (s *SyncAction) syncWindows(store SyncStore, dataset, siteID, serial, timeUnit string, start, end, final time.Time, maxWindow time.Duration, fetch func(from, to time.Time) error) error {
+	from, err := store.SyncedUntil(dataset, siteID, serial, timeUnit)
+	if err != nil {
+		return err
+	}
+	if from.Before(start) {
+		from = start
+	}
+
+	for from.Before(end) {
+		to := from.Add(maxWindow)
+		if to.After(end) {
+			to = end
+		}
+
+		err = fetch(from, to)
+		if err != nil {
+			return err
+		}
+
+		checkpoint := to
+		if checkpoint.After(final) {
+			checkpoint = final
+		}
+		if checkpoint.After(from) {
+			err = store.SetSyncedUntil(dataset, siteID, serial, timeUnit, checkpoint)
+			if err != nil {
+				return err
+			}
+		}
+
+		from = to
+	}
+
+	return nil
+}
@@ -2,8 +2,6 @@ package action
 
 import (
 	"errors"
-	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/dreamlibrarian/solaredge-monitoring/api"
@@ -27,69 +25,64 @@ type TelemetryActionConfig struct {
 	DiscoverSerials bool
 }
 
-func NewTelemetryAction(key string) *TelemetryAction {
+func NewTelemetryAction(key string, opts ...client.Option) *TelemetryAction {
 	return &TelemetryAction{
 		Action: Action{
-			client: client.NewClient(key),
+			client: client.NewClient(key, opts...),
 		},
 	}
 }
 
+// Do fetches telemetry for every site and serial, keyed by site ID then serial.
 func (t *TelemetryAction) Do(config *TelemetryActionConfig) (map[string]map[string][]api.Telemetry, error) {
-
 	siteIDSerialInventoryMap := make(map[string]map[string][]api.Telemetry)
 
+	err := t.Stream(config, func(siteID, serial string, telemetries []api.Telemetry) error {
+		if siteIDSerialInventoryMap[siteID] == nil {
+			siteIDSerialInventoryMap[siteID] = make(map[string][]api.Telemetry)
+		}
+		siteIDSerialInventoryMap[siteID][serial] = telemetries
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return siteIDSerialInventoryMap, nil
+}
+
+// Stream hands each device's telemetry to f as soon as it's fetched, so nothing is held on to
+// for longer than one device; an error from f stops it.
+func (t *TelemetryAction) Stream(config *TelemetryActionConfig, f func(siteID, serial string, telemetries []api.Telemetry) error) error {
 	log.Debug().Msg("Getting Telemetry")
 
 	log.Debug().Interface("Config", config).Msg("Got config")
 	if config.DiscoverSites {
 		if len(config.SiteIDs) > 0 {
-			return nil, errors.New("cannot set all-sites and specify site-ids")
+			return errors.New("cannot set all-sites and specify site-ids")
 		}
-		log.Debug().Msg("Getting sites from upstream.")
-		siteList, err := t.client.GetSiteList()
+		siteIDs, err := t.DiscoverSiteIDs()
 		if err != nil {
-			return nil, err
-		}
-		log.Debug().Interface("sites", siteList).Msg("got sites")
-		for _, site := range siteList {
-			config.SiteIDs = append(config.SiteIDs, strconv.FormatInt(site.ID, 10))
+			return err
 		}
+		config.SiteIDs = siteIDs
 	} else if len(config.SiteIDs) == 0 {
-		return nil, errors.New("must set all-sites or specify at least one site-id")
+		return errors.New("must set all-sites or specify at least one site-id")
 	}
 
 	if config.DiscoverSerials && len(config.SerialNumbers) > 0 {
-		return nil, errors.New("cannot discover serials and specify serials")
-	} else if len(config.SerialNumbers) == 0 {
-		return nil, errors.New("must set all-equipment or specify at least one serial")
+		return errors.New("cannot discover serials and specify serials")
+	} else if !config.DiscoverSerials && len(config.SerialNumbers) == 0 {
+		return errors.New("must set all-equipment or specify at least one serial")
 	}
 
 	for _, siteID := range config.SiteIDs {
-		var serialNumbers []string
-
-		siteIDSerialInventoryMap[siteID] = make(map[string][]api.Telemetry)
+		serialNumbers := config.SerialNumbers
 
 		if config.DiscoverSerials {
-			inventory, err := t.client.GetSiteInventory(siteID)
-			if err != nil {
-				return nil, fmt.Errorf("unable to get inventory for site %s: %w", siteID, err)
-			}
-			log.Debug().Interface("inventory", inventory).Msg("got inventory")
-			for _, inverter := range inventory.Inverters {
-				serialNumbers = append(serialNumbers, inverter.SerialNumber)
-			}
-			for _, gateway := range inventory.Gateways {
-				serialNumbers = append(serialNumbers, gateway.SerialNumber)
-			}
-			for _, battery := range inventory.Batteries {
-				serialNumbers = append(serialNumbers, battery.SerialNumber)
-			}
-			for _, meter := range inventory.Meters {
-				serialNumbers = append(serialNumbers, meter.SerialNumber)
-			}
-			for _, inverter := range inventory.ThirdPartyInverters {
-				serialNumbers = append(serialNumbers, inverter.SerialNumber)
+			var err error
+			if serialNumbers, err = t.DiscoverEquipment(siteID); err != nil {
+				return err
 			}
 		}
 
@@ -101,15 +94,18 @@ func (t *TelemetryAction) Do(config *TelemetryActionConfig) (map[string]map[stri
 			log := log.With().Str("siteid", siteID).Str("serial", serial).Logger()
 			equipment, err := t.client.GetTelemetryForEquipment(siteID, serial, config.TimeUnit, config.StartTime, config.EndTime)
 			if err != nil {
-				return nil, err
+				return err
 			}
 
-			siteIDSerialInventoryMap[siteID][serial] = equipment
-
 			log.Debug().Interface("equipment", equipment).Msg("Got equipment telemetry")
+
+			err = f(siteID, serial, equipment)
+			if err != nil {
+				return err
+			}
 		}
 
 	}
 
-	return siteIDSerialInventoryMap, nil
+	return nil
 }
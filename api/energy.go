@@ -1,11 +1,13 @@
 package api
 
 import (
-	"encoding/json"
-	"fmt"
 	"time"
 )
 
+type EnergyDocument struct {
+	Energy Energy `json:"energy"`
+}
+
 type Energy struct {
 	TimeUnit   string  `json:"timeUnit"`
 	Unit       string  `json:"unit"`
@@ -14,28 +16,13 @@ type Energy struct {
 }
 
 type Value struct {
-	Date  time.Time `json:"date"`
+	Date  Timestamp `json:"date"`
 	Value *int64    `json:"value"`
 }
 
-// UnmarshalJSON for Value has to do the extra work to parse the Date into time.Time
-func (v *Value) UnmarshalJSON(data []byte) error {
-	interimData := struct {
-		Date  string `json:"date"`
-		Value *int64 `json:"value"`
-	}{}
-
-	err := json.Unmarshal(data, &interimData)
-	if err != nil {
-		return fmt.Errorf("unable to parse '%s' as Value : %w", string(data), err)
+// SetLocation moves every value into the site's zone, see WallClockIn.
+func (e *Energy) SetLocation(loc *time.Location) {
+	for i := range e.Values {
+		e.Values[i].Date.SetLocation(loc)
 	}
-
-	timeStamp, err := ParseTime(interimData.Date)
-	if err != nil {
-		return fmt.Errorf("unable to parse %s as date format %s: %w", interimData.Date, DateFormat, err)
-	}
-
-	*v = Value{Date: timeStamp, Value: interimData.Value}
-
-	return nil
 }
@@ -20,16 +20,25 @@ var energyQuarterHourPeriodTestData []byte
 func TestEnergyParse(t *testing.T) {
 	var err error
 
-	var dayEnergy Energy
+	var dayEnergy EnergyDocument
 	err = json.Unmarshal(energyDayPeriodTestData, &dayEnergy)
-	assert.NoErrorf(t, err, "Could not parse day file as Energy")
+	if assert.NoErrorf(t, err, "Could not parse day file as Energy") {
+		assert.Equal(t, TimeUnitDay, dayEnergy.Energy.TimeUnit)
+		assert.NotZero(t, len(dayEnergy.Energy.Values))
+	}
 
-	var hourEnergy Energy
+	var hourEnergy EnergyDocument
 	err = json.Unmarshal(energyHourPeriodTestData, &hourEnergy)
-	assert.NoErrorf(t, err, "Could not parse hour file as Energy")
+	if assert.NoErrorf(t, err, "Could not parse hour file as Energy") {
+		assert.Equal(t, TimeUnitHour, hourEnergy.Energy.TimeUnit)
+		assert.NotZero(t, len(hourEnergy.Energy.Values))
+	}
 
-	var quarterHourEnergy Energy
+	var quarterHourEnergy EnergyDocument
 	err = json.Unmarshal(energyQuarterHourPeriodTestData, &quarterHourEnergy)
-	assert.NoErrorf(t, err, "Could not parse quarterHour file as Energy")
+	if assert.NoErrorf(t, err, "Could not parse quarterHour file as Energy") {
+		assert.Equal(t, TimeUnitQuarterHour, quarterHourEnergy.Energy.TimeUnit)
+		assert.NotZero(t, len(quarterHourEnergy.Energy.Values))
+	}
 
 }
@@ -1,8 +1,6 @@
 package api
 
 import (
-	"encoding/json"
-	"fmt"
 	"time"
 )
 
@@ -15,8 +13,15 @@ type EquipmentData struct {
 	Telemetries []Telemetry `json:"telemetries"`
 }
 
+// SetLocation moves every telemetry reading into the site's zone, see WallClockIn.
+func (e *EquipmentData) SetLocation(loc *time.Location) {
+	for i := range e.Telemetries {
+		e.Telemetries[i].Date.SetLocation(loc)
+	}
+}
+
 type Telemetry struct {
-	Date                  time.Time `json:"date"`
+	Date                  Timestamp `json:"date"`
 	TotalActivePower      float64   `json:"totalActivePower"`
 	DCVoltage             float64   `json:"dcVoltage"`
 	GroundFaultResistance float64   `json:"groundFaultResistance"`
@@ -28,29 +33,6 @@ type Telemetry struct {
 	L1Data                L1Data    `json:"L1Data"`
 }
 
-func (t *Telemetry) UnmarshalJSON(data []byte) error {
-	type TelemetryAlias Telemetry
-
-	interimTelemetry := struct {
-		TelemetryAlias
-		Date string `json:"date"`
-	}{}
-
-	err := json.Unmarshal(data, &interimTelemetry)
-	if err != nil {
-		return fmt.Errorf("unable to parse telemetry to interim format: %w", err)
-	}
-
-	*t = Telemetry(interimTelemetry.TelemetryAlias)
-
-	t.Date, err = ParseTime(interimTelemetry.Date)
-	if err != nil {
-		return fmt.Errorf("unable to parse date %s to time.Time: %w", interimTelemetry.Date, err)
-	}
-
-	return nil
-}
-
 type L1Data struct {
 	ACCurrent     float64 `json:"acCurrent"`
 	ACVoltage     float64 `json:"ACVoltage"`
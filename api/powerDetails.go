@@ -0,0 +1,55 @@
+package api
+
+import (
+	"time"
+)
+
+const (
+	MeterProduction      = "Production"
+	MeterConsumption     = "Consumption"
+	MeterSelfConsumption = "SelfConsumption"
+	MeterFeedIn          = "FeedIn"
+	MeterPurchased       = "Purchased"
+)
+
+type PowerDetailsDocument struct {
+	PowerDetails PowerDetails `json:"powerDetails"`
+}
+
+// PowerDetails is average power per period, per meter. Sites without a consumption meter only
+// have Production.
+type PowerDetails struct {
+	TimeUnit string       `json:"timeUnit"`
+	Unit     string       `json:"unit"`
+	Meters   []PowerMeter `json:"meters"`
+}
+
+type PowerMeter struct {
+	Type   string       `json:"type"`
+	Values []PowerValue `json:"values"`
+}
+
+// PowerValue is like Value, except power comes with a fractional part.
+type PowerValue struct {
+	Date  Timestamp `json:"date"`
+	Value *float64  `json:"value"`
+}
+
+// Meter finds a meter by type, nil if the site doesn't have it.
+func (p *PowerDetails) Meter(meterType string) *PowerMeter {
+	for i := range p.Meters {
+		if p.Meters[i].Type == meterType {
+			return &p.Meters[i]
+		}
+	}
+	return nil
+}
+
+// SetLocation moves every value into the site's zone, see WallClockIn.
+func (p *PowerDetails) SetLocation(loc *time.Location) {
+	for i := range p.Meters {
+		for j := range p.Meters[i].Values {
+			p.Meters[i].Values[j].Date.SetLocation(loc)
+		}
+	}
+}
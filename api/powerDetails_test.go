@@ -0,0 +1,36 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go:embed testdata/powerDetails-hour.json
+var powerDetailsData []byte
+
+func TestPowerDetailsParse(t *testing.T) {
+	var document PowerDetailsDocument
+	err := json.Unmarshal(powerDetailsData, &document)
+	if !assert.NoError(t, err, "unable to parse power details") {
+		return
+	}
+
+	details := document.PowerDetails
+	assert.Equal(t, TimeUnitQuarterHour, details.TimeUnit)
+	assert.Equal(t, "W", details.Unit)
+	assert.Nil(t, details.Meter("NoSuchMeter"))
+
+	production := details.Meter(MeterProduction)
+	if assert.NotNil(t, production) && assert.NotEmpty(t, production.Values) {
+		var fractional bool
+		for _, v := range production.Values {
+			if v.Value != nil && *v.Value != float64(int64(*v.Value)) {
+				fractional = true
+			}
+		}
+		assert.True(t, fractional, "power should keep its fractional part")
+	}
+}
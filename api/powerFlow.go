@@ -0,0 +1,42 @@
+package api
+
+// PowerFlowDocument is the response from the site's currentPowerFlow endpoint.
+type PowerFlowDocument struct {
+	PowerFlow PowerFlow `json:"siteCurrentPowerFlow"`
+}
+
+// PowerFlow is a snapshot of where power is going right now. Elements the site doesn't have, like
+// STORAGE without a battery, are nil.
+type PowerFlow struct {
+	UpdateRefreshRate int64                 `json:"updateRefreshRate"`
+	Unit              string                `json:"unit"`
+	Connections       []PowerFlowConnection `json:"connections"`
+	Grid              *PowerFlowElement     `json:"GRID"`
+	Load              *PowerFlowElement     `json:"LOAD"`
+	PV                *PowerFlowElement     `json:"PV"`
+	Storage           *PowerFlowElement     `json:"STORAGE"`
+}
+
+type PowerFlowConnection struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type PowerFlowElement struct {
+	Status       string  `json:"status"`
+	CurrentPower float64 `json:"currentPower"`
+	// ChargeLevel is the battery's state of charge in percent; only STORAGE has it.
+	ChargeLevel *float64 `json:"chargeLevel"`
+	Critical    bool     `json:"critical"`
+}
+
+// Watts converts a power reported in the flow's unit, usually kW, to W.
+func (p *PowerFlow) Watts(power float64) float64 {
+	switch p.Unit {
+	case "W":
+		return power
+	case "MW":
+		return power * 1e6
+	}
+	return power * 1e3
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go:embed testdata/current-power-flow.json
+var powerFlowData []byte
+
+func TestPowerFlowParse(t *testing.T) {
+	var document PowerFlowDocument
+	err := json.Unmarshal(powerFlowData, &document)
+	if !assert.NoError(t, err, "unable to parse current power flow") {
+		return
+	}
+
+	flow := document.PowerFlow
+	if assert.NotNil(t, flow.PV) {
+		assert.Equal(t, 4620.0, flow.Watts(flow.PV.CurrentPower))
+	}
+	if assert.NotNil(t, flow.Storage) && assert.NotNil(t, flow.Storage.ChargeLevel) {
+		assert.Equal(t, 61.0, *flow.Storage.ChargeLevel)
+		assert.Equal(t, "Charging", flow.Storage.Status)
+	}
+	assert.Len(t, flow.Connections, 3)
+
+	var withoutBattery PowerFlowDocument
+	err = json.Unmarshal([]byte(`{"siteCurrentPowerFlow":{"unit":"W","PV":{"status":"Idle","currentPower":0}}}`), &withoutBattery)
+	assert.NoError(t, err)
+	assert.Nil(t, withoutBattery.PowerFlow.Storage)
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -23,9 +22,9 @@ type SiteDetails struct {
 	AccountID        int64             `json:"accountId"`
 	Status           string            `json:"status"`
 	PeakPower        float64           `json:"peakPower"`
-	LastUpdateTime   time.Time         `json:"lastUpdateTime"`
-	InstallationDate time.Time         `json:"installationDate"`
-	PTODate          time.Time         `json:"ptoDate"`
+	LastUpdateTime   Timestamp         `json:"lastUpdateTime"`
+	InstallationDate Timestamp         `json:"installationDate"`
+	PTODate          Timestamp         `json:"ptoDate"`
 	Notes            string            `json:"notes"`
 	Type             string            `json:"type"`
 	Location         Location          `json:"location"`
@@ -34,43 +33,11 @@ type SiteDetails struct {
 	PublicSettings   PublicSettings    `json:"publicSettings"`
 }
 
-func (s *SiteDetails) UnmarshalJSON(data []byte) error {
-	type SiteDetailsAlias SiteDetails
-	interimData := struct {
-		SiteDetailsAlias
-		LastUpdateTime   string `json:"lastUpdateTime"`
-		InstallationDate string `json:"installationDate"`
-		PTODate          string `json:"ptoDate"`
-	}{}
-	err := json.Unmarshal(data, &interimData)
-	if err != nil {
-		return fmt.Errorf("unable to unmarshal data %s to interim data structure: %w", data, err)
-	}
-
-	*s = SiteDetails(interimData.SiteDetailsAlias)
-
-	if interimData.LastUpdateTime != "" {
-		s.LastUpdateTime, err = ParseDate(interimData.LastUpdateTime)
-		if err != nil {
-			return fmt.Errorf("unable to parse lastUpdateTime %s with format %s: %w", interimData.LastUpdateTime, TimeFormat, err)
-		}
-	}
-
-	if interimData.InstallationDate != "" {
-		s.InstallationDate, err = ParseDate(interimData.InstallationDate)
-		if err != nil {
-			return fmt.Errorf("unable to parse installationDate %s with format %s: %w", interimData.InstallationDate, TimeFormat, err)
-		}
-	}
-
-	if interimData.PTODate != "" {
-		s.PTODate, err = ParseTime(interimData.PTODate)
-		if err != nil {
-			return fmt.Errorf("unable to parse PTODate %s with format %s: %w", interimData.PTODate, TimeFormat, err)
-		}
-	}
-
-	return nil
+// SetLocation moves the site's own timestamps into its zone, see WallClockIn.
+func (s *SiteDetails) SetLocation(loc *time.Location) {
+	s.LastUpdateTime.SetLocation(loc)
+	s.InstallationDate.SetLocation(loc)
+	s.PTODate.SetLocation(loc)
 }
 
 type Location struct {
@@ -85,6 +52,18 @@ type Location struct {
 	StateCode   string `json:"stateCode"`
 }
 
+// TimeLocation loads the site's zone, falling back to UTC for sites that don't report one.
+func (l Location) TimeLocation() (*time.Location, error) {
+	if l.TimeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(l.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load time zone %s: %w", l.TimeZone, err)
+	}
+	return loc, nil
+}
+
 type PrimaryModule struct {
 	ManufacturerName       string  `json:"manufacturerName"`
 	ModelName              string  `json:"modelName"`
@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,3 +27,18 @@ func TestSiteDetailsParse(t *testing.T) {
 	}
 
 }
+
+func TestSiteDetailsLocation(t *testing.T) {
+	var siteDetailsDocument SiteDetailsDocument
+	err := json.Unmarshal(siteDetailsData, &siteDetailsDocument)
+	if !assert.NoError(t, err, "unable to parse site details") {
+		return
+	}
+	siteDetails := siteDetailsDocument.Details
+
+	loc, err := siteDetails.Location.TimeLocation()
+	if assert.NoError(t, err, "unable to load site time zone") {
+		siteDetails.SetLocation(loc)
+		assert.Equal(t, "2021-08-19T00:00:00-07:00", siteDetails.InstallationDate.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timestampFormats are tried in order. The first three are what the monitoring API emits; RFC 3339
+// is what we write ourselves, so stored output can be read back in.
+var timestampFormats = []string{
+	TimeFormat,
+	"2006-01-02 15:04",
+	DateFormat,
+	time.RFC3339Nano,
+}
+
+// Timestamp is a time decoded from the monitoring API. It keeps the string it came from, since
+// the API's wall clock times only mean something once we know the site's zone.
+type Timestamp struct {
+	time.Time
+
+	// Raw is the string as the API sent it.
+	Raw string
+
+	// zoned is set when Raw carried its own offset, so there's no need to move it into a site zone.
+	zoned bool
+}
+
+// ParseTimestamp accepts any of the date and time formats the monitoring API uses, as UTC.
+func ParseTimestamp(raw string) (Timestamp, error) {
+	trimmed := strings.TrimSpace(raw)
+	for _, format := range timestampFormats {
+		t, err := time.Parse(format, trimmed)
+		if err == nil {
+			return Timestamp{Time: t, Raw: raw, zoned: format == time.RFC3339Nano}, nil
+		}
+	}
+	return Timestamp{Raw: raw}, fmt.Errorf("unable to parse %q as any of %s", raw, strings.Join(timestampFormats, ", "))
+}
+
+// SetLocation keeps the wall clock reading but moves it into loc, see WallClockIn. Timestamps that
+// came with their own offset are left alone.
+func (t *Timestamp) SetLocation(loc *time.Location) {
+	if t.zoned {
+		return
+	}
+	t.Time = WallClockIn(t.Time, loc)
+}
+
+// UnmarshalJSON treats null and empty strings as the zero Timestamp, which the API uses for
+// dates it doesn't have, like ptoDate on sites still waiting on permission to operate.
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*t = Timestamp{}
+		return nil
+	}
+
+	var raw string
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return fmt.Errorf("unable to parse '%s' as a timestamp string: %w", string(data), err)
+	}
+	if strings.TrimSpace(raw) == "" {
+		*t = Timestamp{Raw: raw}
+		return nil
+	}
+
+	*t, err = ParseTimestamp(raw)
+	return err
+}
+
+// MarshalJSON writes RFC 3339 with the offset, so output means the same thing wherever it's read.
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Format(time.RFC3339))
+}
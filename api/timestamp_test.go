@@ -0,0 +1,125 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go:embed testdata/sites-list.json
+var sitesListData []byte
+
+func TestParseTimestamp(t *testing.T) {
+	for raw, expected := range map[string]time.Time{
+		"2021-11-23 08:43:41":       time.Date(2021, 11, 23, 8, 43, 41, 0, time.UTC),
+		"2021-11-23 08:43":          time.Date(2021, 11, 23, 8, 43, 0, 0, time.UTC),
+		"2021-11-23":                time.Date(2021, 11, 23, 0, 0, 0, 0, time.UTC),
+		"2021-11-23T08:43:41-08:00": time.Date(2021, 11, 23, 16, 43, 41, 0, time.UTC),
+	} {
+		ts, err := ParseTimestamp(raw)
+		if assert.NoError(t, err, "unable to parse %s", raw) {
+			assert.True(t, expected.Equal(ts.Time), "%s parsed as %s", raw, ts.Time)
+			assert.Equal(t, raw, ts.Raw)
+		}
+	}
+
+	_, err := ParseTimestamp("23/11/2021")
+	assert.Error(t, err)
+}
+
+func TestTimestampJSON(t *testing.T) {
+	var ts Timestamp
+
+	assert.NoError(t, json.Unmarshal([]byte(`null`), &ts))
+	assert.True(t, ts.IsZero())
+	assert.NoError(t, json.Unmarshal([]byte(`""`), &ts))
+	assert.True(t, ts.IsZero())
+	assert.Error(t, json.Unmarshal([]byte(`12`), &ts))
+
+	assert.NoError(t, json.Unmarshal([]byte(`"2021-11-07 01:30:00"`), &ts))
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if assert.NoError(t, err) {
+		ts.SetLocation(loc)
+		data, err := json.Marshal(ts)
+		if assert.NoError(t, err) {
+			assert.Equal(t, `"2021-11-07T01:30:00-07:00"`, string(data))
+		}
+
+		var roundTripped Timestamp
+		if assert.NoError(t, json.Unmarshal(data, &roundTripped)) {
+			roundTripped.SetLocation(time.UTC)
+			assert.True(t, ts.Equal(roundTripped.Time), "zoned timestamps shouldn't move when read back")
+		}
+	}
+}
+
+func FuzzParseTimestamp(f *testing.F) {
+	for _, seed := range []string{
+		"2021-11-23 08:43:41",
+		"2021-11-23 08:43",
+		"2021-11-23",
+		"2021-11-23T08:43:41-08:00",
+		"",
+		" 2021-11-23 ",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		ts, err := ParseTimestamp(raw)
+		if err != nil {
+			return
+		}
+		assert.Equal(t, raw, ts.Raw)
+
+		again, err := ParseTimestamp(ts.Raw)
+		if assert.NoError(t, err, "raw string should parse again") {
+			assert.True(t, ts.Equal(again.Time))
+		}
+	})
+}
+
+// FuzzDocuments feeds mangled versions of every document we know about through every document type;
+// nothing should panic, and whatever does decode should survive a round trip through our own output.
+func FuzzDocuments(f *testing.F) {
+	for _, seed := range [][]byte{
+		energyDayPeriodTestData,
+		energyHourPeriodTestData,
+		energyQuarterHourPeriodTestData,
+		equipmentDataData,
+		inventoryData,
+		documentationInventoryData,
+		siteDetailsData,
+		sitesListData,
+		powerFlowData,
+		powerDetailsData,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, newDocument := range []func() interface{}{
+			func() interface{} { return &EnergyDocument{} },
+			func() interface{} { return &EquipmentDataDocument{} },
+			func() interface{} { return &InventoryDocument{} },
+			func() interface{} { return &SiteDetailsDocument{} },
+			func() interface{} { return &SiteListDocument{} },
+			func() interface{} { return &PowerFlowDocument{} },
+			func() interface{} { return &PowerDetailsDocument{} },
+		} {
+			document := newDocument()
+			if json.Unmarshal(data, document) != nil {
+				continue
+			}
+
+			output, err := json.Marshal(document)
+			if !assert.NoError(t, err, "unable to marshal %T", document) {
+				continue
+			}
+			assert.NoError(t, json.Unmarshal(output, newDocument()), "unable to read back %T", document)
+		}
+	})
+}
@@ -21,10 +21,28 @@ func ToTimestamp(t time.Time) string {
 	return t.Format(TimeFormat)
 }
 
+// ParseDate parses a date as UTC; the API doesn't say which zone it means, see WallClockIn.
 func ParseDate(stamp string) (time.Time, error) {
 	return time.Parse(DateFormat, stamp)
 }
 
+// ParseTime parses a timestamp as UTC; the API doesn't say which zone it means, see WallClockIn.
 func ParseTime(stamp string) (time.Time, error) {
 	return time.Parse(TimeFormat, stamp)
 }
+
+func ParseTimeIn(stamp string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation(TimeFormat, stamp, loc)
+}
+
+// WallClockIn keeps the wall clock reading of t but moves it into loc. The monitoring API reports
+// site-local wall clock times with no offset, so anything parsed from it needs to go through here
+// once the site's zone is known.
+func WallClockIn(t time.Time, loc *time.Location) time.Time {
+	if t.IsZero() || loc == nil {
+		return t
+	}
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	return time.Date(year, month, day, hour, min, sec, t.Nanosecond(), loc)
+}
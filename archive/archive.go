@@ -0,0 +1,259 @@
+// Package archive keeps a local SQLite database of everything sync has fetched.
+package archive
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	_ "github.com/ncruces/go-sqlite3/driver" // registers the sqlite3 database/sql driver
+	_ "github.com/ncruces/go-sqlite3/embed"  // bundles SQLite itself, so there's no cgo
+)
+
+const driverName = "sqlite3"
+
+// schema is applied in order; each statement is safe to run again against an existing database.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS sites (
+		site_id    TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		time_zone  TEXT NOT NULL,
+		details    TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS inventory_snapshots (
+		site_id    TEXT NOT NULL,
+		fetched_at TEXT NOT NULL,
+		inventory  TEXT NOT NULL,
+		PRIMARY KEY (site_id, fetched_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS energy (
+		site_id   TEXT NOT NULL,
+		time_unit TEXT NOT NULL,
+		time      INTEGER NOT NULL,
+		local_time TEXT NOT NULL,
+		unit      TEXT NOT NULL,
+		value     INTEGER,
+		PRIMARY KEY (site_id, time_unit, time)
+	)`,
+	`CREATE TABLE IF NOT EXISTS telemetry (
+		site_id                 TEXT NOT NULL,
+		serial                  TEXT NOT NULL,
+		time                    INTEGER NOT NULL,
+		local_time              TEXT NOT NULL,
+		total_active_power      REAL,
+		dc_voltage              REAL,
+		ground_fault_resistance REAL,
+		power_limit             REAL,
+		total_energy            REAL,
+		temperature             REAL,
+		inverter_mode           TEXT,
+		operation_mode          REAL,
+		l1_ac_current           REAL,
+		l1_ac_voltage           REAL,
+		l1_ac_frequency         REAL,
+		l1_apparent_power       REAL,
+		l1_active_power         REAL,
+		l1_reactive_power       REAL,
+		l1_cos_phi              REAL,
+		PRIMARY KEY (site_id, serial, time)
+	)`,
+	`CREATE TABLE IF NOT EXISTS sync_state (
+		dataset      TEXT NOT NULL,
+		site_id      TEXT NOT NULL,
+		serial       TEXT NOT NULL,
+		time_unit    TEXT NOT NULL,
+		synced_until TEXT NOT NULL,
+		PRIMARY KEY (dataset, site_id, serial, time_unit)
+	)`,
+}
+
+// Archive is a SQLite database of sites, inventory, energy and telemetry. Times are stored as
+// unix seconds for ordering and joins, alongside the site-local RFC 3339 rendering for people.
+type Archive struct {
+	db *sql.DB
+}
+
+func Open(path string) (*Archive, error) {
+	db, err := sql.Open(driverName, "file:"+path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open archive %s: %w", path, err)
+	}
+	// SQLite only does one writer at a time anyway.
+	db.SetMaxOpenConns(1)
+
+	for _, statement := range schema {
+		_, err = db.Exec(statement)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("unable to set up archive schema in %s: %w", path, err)
+		}
+	}
+
+	return &Archive{db: db}, nil
+}
+
+func (a *Archive) Close() error {
+	return a.db.Close()
+}
+
+// DB exposes the database for ad-hoc queries.
+func (a *Archive) DB() *sql.DB {
+	return a.db
+}
+
+func (a *Archive) SyncedUntil(dataset, siteID, serial, timeUnit string) (time.Time, error) {
+	var until string
+	err := a.db.QueryRow(
+		`SELECT synced_until FROM sync_state WHERE dataset = ? AND site_id = ? AND serial = ? AND time_unit = ?`,
+		dataset, siteID, serial, timeUnit,
+	).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, until)
+}
+
+func (a *Archive) SetSyncedUntil(dataset, siteID, serial, timeUnit string, until time.Time) error {
+	_, err := a.db.Exec(
+		`INSERT INTO sync_state (dataset, site_id, serial, time_unit, synced_until) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (dataset, site_id, serial, time_unit) DO UPDATE SET synced_until = excluded.synced_until`,
+		dataset, siteID, serial, timeUnit, until.Format(time.RFC3339),
+	)
+	return err
+}
+
+func (a *Archive) PutSite(site *api.SiteDetails) error {
+	details, err := json.Marshal(site)
+	if err != nil {
+		return err
+	}
+	_, err = a.db.Exec(
+		`INSERT INTO sites (site_id, name, time_zone, details, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (site_id) DO UPDATE SET
+			name = excluded.name, time_zone = excluded.time_zone, details = excluded.details, updated_at = excluded.updated_at`,
+		strconv.FormatInt(site.ID, 10), site.Name, site.Location.TimeZone, string(details), time.Now().UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+// PutInventory only keeps a new snapshot when the inventory has changed since the last one.
+func (a *Archive) PutInventory(siteID string, fetchedAt time.Time, inventory *api.Inventory) error {
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return err
+	}
+
+	var latest string
+	err = a.db.QueryRow(
+		`SELECT inventory FROM inventory_snapshots WHERE site_id = ? ORDER BY fetched_at DESC LIMIT 1`,
+		siteID,
+	).Scan(&latest)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if latest == string(data) {
+		return nil
+	}
+
+	_, err = a.db.Exec(
+		`INSERT INTO inventory_snapshots (site_id, fetched_at, inventory) VALUES (?, ?, ?)
+		ON CONFLICT (site_id, fetched_at) DO UPDATE SET inventory = excluded.inventory`,
+		siteID, fetchedAt.UTC().Format(time.RFC3339), string(data),
+	)
+	return err
+}
+
+func (a *Archive) PutEnergy(siteID string, energy *api.Energy) error {
+	return a.inTransaction(func(tx *sql.Tx) error {
+		statement, err := tx.Prepare(
+			`INSERT INTO energy (site_id, time_unit, time, local_time, unit, value) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (site_id, time_unit, time) DO UPDATE SET
+				local_time = excluded.local_time, unit = excluded.unit, value = excluded.value`,
+		)
+		if err != nil {
+			return err
+		}
+		defer statement.Close()
+
+		for _, v := range energy.Values {
+			var value sql.NullInt64
+			if v.Value != nil {
+				value = sql.NullInt64{Int64: *v.Value, Valid: true}
+			}
+			_, err = statement.Exec(siteID, energy.TimeUnit, v.Date.Unix(), v.Date.Format(time.RFC3339), energy.Unit, value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (a *Archive) PutTelemetry(siteID, serial string, telemetries []api.Telemetry) error {
+	return a.inTransaction(func(tx *sql.Tx) error {
+		statement, err := tx.Prepare(
+			`INSERT INTO telemetry (
+				site_id, serial, time, local_time,
+				total_active_power, dc_voltage, ground_fault_resistance, power_limit, total_energy,
+				temperature, inverter_mode, operation_mode,
+				l1_ac_current, l1_ac_voltage, l1_ac_frequency, l1_apparent_power, l1_active_power,
+				l1_reactive_power, l1_cos_phi
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (site_id, serial, time) DO UPDATE SET
+				local_time = excluded.local_time,
+				total_active_power = excluded.total_active_power,
+				dc_voltage = excluded.dc_voltage,
+				ground_fault_resistance = excluded.ground_fault_resistance,
+				power_limit = excluded.power_limit,
+				total_energy = excluded.total_energy,
+				temperature = excluded.temperature,
+				inverter_mode = excluded.inverter_mode,
+				operation_mode = excluded.operation_mode,
+				l1_ac_current = excluded.l1_ac_current,
+				l1_ac_voltage = excluded.l1_ac_voltage,
+				l1_ac_frequency = excluded.l1_ac_frequency,
+				l1_apparent_power = excluded.l1_apparent_power,
+				l1_active_power = excluded.l1_active_power,
+				l1_reactive_power = excluded.l1_reactive_power,
+				l1_cos_phi = excluded.l1_cos_phi`,
+		)
+		if err != nil {
+			return err
+		}
+		defer statement.Close()
+
+		for _, t := range telemetries {
+			_, err = statement.Exec(
+				siteID, serial, t.Date.Unix(), t.Date.Format(time.RFC3339),
+				t.TotalActivePower, t.DCVoltage, t.GroundFaultResistance, t.PowerLimit, t.TotalEnergy,
+				t.Temperature, t.InverterMode, t.OperationMode,
+				t.L1Data.ACCurrent, t.L1Data.ACVoltage, t.L1Data.ACFrequency, t.L1Data.ApparentPower, t.L1Data.ActivePower,
+				t.L1Data.ReactivePower, t.L1Data.CosPhi,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (a *Archive) inTransaction(f func(tx *sql.Tx) error) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = f(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,137 @@
+package archive
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func TestArchiveUpserts(t *testing.T) {
+	a, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer a.Close()
+
+	day := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	energy := &api.Energy{
+		TimeUnit: api.TimeUnitDay,
+		Unit:     "Wh",
+		Values: []api.Value{
+			{Date: api.Timestamp{Time: day}, Value: int64Ptr(100)},
+			{Date: api.Timestamp{Time: day.Add(24 * time.Hour)}},
+		},
+	}
+	assert.NoError(t, a.PutEnergy("12345", energy))
+
+	energy.Values[1].Value = int64Ptr(250)
+	assert.NoError(t, a.PutEnergy("12345", energy))
+
+	var count, total int64
+	err = a.DB().QueryRow(`SELECT COUNT(*), SUM(value) FROM energy WHERE site_id = ?`, "12345").Scan(&count, &total)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count, "values should be upserted on timestamp, not duplicated")
+	assert.EqualValues(t, 350, total)
+
+	inventory := &api.Inventory{Inverters: []api.Inverter{{Name: "Inverter 1", SerialNumber: "7E1234AB-12"}}}
+	assert.NoError(t, a.PutInventory("12345", day, inventory))
+	assert.NoError(t, a.PutInventory("12345", day.Add(time.Hour), inventory))
+	inventory.Inverters = append(inventory.Inverters, api.Inverter{Name: "Inverter 2", SerialNumber: "7E1234AB-13"})
+	assert.NoError(t, a.PutInventory("12345", day.Add(2*time.Hour), inventory))
+
+	err = a.DB().QueryRow(`SELECT COUNT(*) FROM inventory_snapshots WHERE site_id = ?`, "12345").Scan(&count)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count, "unchanged inventory shouldn't make a new snapshot")
+
+	until, err := a.SyncedUntil(action.DatasetEnergy, "12345", "", api.TimeUnitDay)
+	assert.NoError(t, err)
+	assert.True(t, until.IsZero())
+
+	assert.NoError(t, a.SetSyncedUntil(action.DatasetEnergy, "12345", "", api.TimeUnitDay, day))
+	assert.NoError(t, a.SetSyncedUntil(action.DatasetEnergy, "12345", "", api.TimeUnitDay, day.Add(24*time.Hour)))
+	until, err = a.SyncedUntil(action.DatasetEnergy, "12345", "", api.TimeUnitDay)
+	assert.NoError(t, err)
+	assert.True(t, day.Add(24*time.Hour).Equal(until))
+
+	until, err = a.SyncedUntil(action.DatasetEnergy, "12345", "", api.TimeUnitHour)
+	assert.NoError(t, err)
+	assert.True(t, until.IsZero(), "each time unit should be synced separately")
+}
+
+func TestIncrementalSync(t *testing.T) {
+	var energyStarts, telemetryStarts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		start := r.URL.Query().Get("startTime")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/details"):
+			w.Write([]byte(`{"details":{"id":12345,"name":"Home","installationDate":"2021-10-30","location":{"timeZone":"America/Los_Angeles"}}}`))
+		case strings.HasSuffix(r.URL.Path, "/inventory"):
+			w.Write([]byte(`{"Inventory":{"inverters":[{"name":"Inverter 1","SN":"7E1234AB-12"}]}}`))
+		case strings.HasSuffix(r.URL.Path, "/energy"):
+			energyStarts = append(energyStarts, start)
+			fmt.Fprintf(w, `{"energy":{"timeUnit":"DAY","unit":"Wh","values":[{"date":%q,"value":100}]}}`, start)
+		case strings.HasSuffix(r.URL.Path, "/data"):
+			telemetryStarts = append(telemetryStarts, start)
+			fmt.Fprintf(w, `{"data":{"count":1,"telemetries":[{"date":%q,"totalActivePower":1500}]}}`, start)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer a.Close()
+
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sync := action.NewSyncAction("secret-key", client.WithBaseURL(server.URL))
+	config := &action.SyncConfig{
+		EndTime:  time.Date(2021, 11, 2, 12, 0, 0, 0, la),
+		TimeUnit: api.TimeUnitDay,
+		SiteIDs:  []string{"12345"},
+	}
+	if !assert.NoError(t, sync.Do(config, a)) {
+		return
+	}
+	assert.Equal(t, []string{"2021-10-30 00:00:00"}, energyStarts, "first sync should start at installation")
+	assert.Equal(t, []string{"2021-10-30 00:00:00"}, telemetryStarts)
+
+	config.EndTime = time.Date(2021, 11, 3, 12, 0, 0, 0, la)
+	if !assert.NoError(t, sync.Do(config, a)) {
+		return
+	}
+	assert.Equal(t, "2021-11-02 00:00:00", energyStarts[1], "second sync should pick up from the start of the last partial day")
+	assert.Equal(t, "2021-11-02 00:00:00", telemetryStarts[1])
+
+	until, err := a.SyncedUntil(action.DatasetTelemetry, "12345", "7E1234AB-12", "")
+	assert.NoError(t, err)
+	assert.True(t, time.Date(2021, 11, 3, 0, 0, 0, 0, la).Equal(until))
+
+	var count int
+	err = a.DB().QueryRow(`SELECT COUNT(*) FROM energy`).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	err = a.DB().QueryRow(`SELECT COUNT(*) FROM sites WHERE time_zone = ?`, "America/Los_Angeles").Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
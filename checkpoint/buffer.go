@@ -0,0 +1,75 @@
+package checkpoint
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Buffer holds advances back until Commit, for output that's only safely written once it's
+// closed; a run that fails before then leaves its checkpoints where they were, to fetch again.
+// Everything else goes straight through to the store.
+type Buffer struct {
+	Store
+
+	lock    sync.Mutex
+	pending map[Key]*advance
+	order   []Key
+}
+
+type advance struct {
+	previous time.Time
+	t        time.Time
+}
+
+func NewBuffer(store Store) *Buffer {
+	return &Buffer{Store: store, pending: make(map[Key]*advance)}
+}
+
+// Get sees advances that haven't been committed yet, so a run carries on from its own progress.
+func (b *Buffer) Get(k Key) (time.Time, error) {
+	b.lock.Lock()
+	a, ok := b.pending[k]
+	b.lock.Unlock()
+	if ok {
+		return a.t, nil
+	}
+	return b.Store.Get(k)
+}
+
+func (b *Buffer) Advance(k Key, previous, t time.Time) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if a, ok := b.pending[k]; ok {
+		if !a.t.Equal(previous) {
+			return fmt.Errorf("%s is at %s, not %s: %w", k, Format(a.t), Format(previous), ErrConflict)
+		}
+		a.t = t
+		return nil
+	}
+	b.pending[k] = &advance{previous: previous, t: t}
+	b.order = append(b.order, k)
+	return nil
+}
+
+// Commit makes the held advances in the store, in the order they were made. One that conflicts is
+// reported, and doesn't stop the rest.
+func (b *Buffer) Commit() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var errs error
+	for _, k := range b.order {
+		a := b.pending[k]
+		if err := b.Store.Advance(k, a.previous, a.t); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	b.pending = make(map[Key]*advance)
+	b.order = nil
+	return errs
+}
@@ -0,0 +1,168 @@
+// Package checkpoint keeps track of how far each collector has got, per site, action and device,
+// so each one can move on without waiting for the others.
+package checkpoint
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+)
+
+const (
+	ActionEnergy    = "energy"
+	ActionTelemetry = "telemetry"
+)
+
+// LegacyKey is the object, under the bucket prefix, where the collector kept one checkpoint for
+// every site's energy before checkpoints were kept per site and action.
+const LegacyKey = "solaredge-monitoring-checkpoint"
+
+// ErrConflict is returned by Advance when something else has moved a checkpoint since it was
+// read, most likely another run of the collector.
+var ErrConflict = errors.New("checkpoint was moved by someone else")
+
+// Store keeps checkpoints somewhere that outlives a run.
+type Store interface {
+	// Get returns the zero time for a checkpoint that hasn't been written yet.
+	Get(k Key) (time.Time, error)
+	// Advance moves k from previous, the zero time if it had none, to t, failing with ErrConflict
+	// if it isn't at previous any more.
+	Advance(k Key, previous, t time.Time) error
+	// Set moves k to t wherever it was, for resets.
+	Set(k Key, t time.Time) error
+	// Delete resets a checkpoint, so the next run starts from its default again.
+	Delete(k Key) error
+	// List returns every checkpoint, sorted by key.
+	List() ([]Checkpoint, error)
+}
+
+// Legacy is how far the collector's old single checkpoint had got, the zero time if store has
+// never had one. Only S3 stores could.
+func Legacy(store Store) (time.Time, error) {
+	legacy, ok := store.(interface{ Legacy() (time.Time, error) })
+	if !ok {
+		return time.Time{}, nil
+	}
+	return legacy.Legacy()
+}
+
+// Checkpoint is a key and how far it's got.
+type Checkpoint struct {
+	Key  Key
+	Time time.Time
+}
+
+// Open picks a store by URI: s3://bucket/prefix, dynamodb://table/prefix, or a file path, with
+// or without file://. AWS credentials come from the usual environment and config files.
+func Open(uri string) (Store, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse checkpoints %s: %w", uri, err)
+	}
+
+	switch u.Scheme {
+	case "", "file":
+		path := u.Path
+		if u.Scheme == "" {
+			path = uri
+		}
+		if path == "" {
+			return nil, fmt.Errorf("checkpoints %s needs a path", uri)
+		}
+		return NewFileStore(path), nil
+	case "s3", "dynamodb":
+		if u.Host == "" {
+			return nil, fmt.Errorf("checkpoints %s needs a bucket or table name", uri)
+		}
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		prefix := strings.Trim(u.Path, "/")
+		if u.Scheme == "s3" {
+			return NewS3Store(s3.New(sess), u.Host, prefix), nil
+		}
+		return NewDynamoDBStore(dynamodb.New(sess), u.Host, prefix), nil
+	default:
+		return nil, fmt.Errorf("checkpoints %s should be s3://, dynamodb:// or a file", uri)
+	}
+}
+
+// Key names one checkpoint. Energy is tracked per site, telemetry per site and serial.
+type Key struct {
+	Action string
+	SiteID string
+	Serial string
+}
+
+func (k Key) String() string {
+	if k.Serial == "" {
+		return k.Action + "/" + k.SiteID
+	}
+	return k.Action + "/" + k.SiteID + "/" + k.Serial
+}
+
+// Validate checks that a key names something a collector would actually keep.
+func (k Key) Validate() error {
+	for _, part := range []string{k.Action, k.SiteID, k.Serial} {
+		if strings.Contains(part, "/") {
+			return fmt.Errorf("checkpoint key parts can't contain '/': %q", part)
+		}
+	}
+	switch {
+	case k.SiteID == "":
+		return fmt.Errorf("checkpoint %s has no site", k)
+	case k.Action == ActionEnergy && k.Serial != "":
+		return fmt.Errorf("energy checkpoints are per site, not per serial: %s", k)
+	case k.Action == ActionTelemetry && k.Serial == "":
+		return fmt.Errorf("telemetry checkpoints need a serial: %s", k)
+	case k.Action != ActionEnergy && k.Action != ActionTelemetry:
+		return fmt.Errorf("unknown checkpoint action %q", k.Action)
+	}
+	return nil
+}
+
+// ParseKey reverses Key.String.
+func ParseKey(s string) (Key, error) {
+	parts := strings.Split(s, "/")
+	var k Key
+	switch len(parts) {
+	case 2:
+		k = Key{Action: parts[0], SiteID: parts[1]}
+	case 3:
+		k = Key{Action: parts[0], SiteID: parts[1], Serial: parts[2]}
+	default:
+		return Key{}, fmt.Errorf("%q isn't a checkpoint key", s)
+	}
+	return k, k.Validate()
+}
+
+// Format is how checkpoints are written.
+func Format(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// Parse reads RFC 3339 checkpoints, and the zoneless ones we used to write, which were UTC.
+func Parse(stamp string) (time.Time, error) {
+	stamp = strings.TrimSpace(stamp)
+	t, err := time.Parse(time.RFC3339, stamp)
+	if err == nil {
+		return t, nil
+	}
+	return api.ParseTime(stamp)
+}
+
+// sortCheckpoints puts checkpoints in key order, which groups them by action and then site.
+func sortCheckpoints(checkpoints []Checkpoint) {
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].Key.String() < checkpoints[j].Key.String()
+	})
+}
@@ -0,0 +1,263 @@
+package checkpoint
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 keeps objects in a map; anything else it's asked panics on the nil interface.
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}}
+}
+
+func (f *fakeS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	data, ok := f.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "no such key", nil)
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.StringValue(input.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	delete(f.objects, aws.StringValue(input.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	page := &s3.ListObjectsV2Output{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			page.Contents = append(page.Contents, &s3.Object{Key: aws.String(key)})
+		}
+	}
+	fn(page, true)
+	return nil
+}
+
+func TestKeys(t *testing.T) {
+	k, err := ParseKey("telemetry/12345/7E1234AB-12")
+	if assert.NoError(t, err) {
+		assert.Equal(t, Key{Action: ActionTelemetry, SiteID: "12345", Serial: "7E1234AB-12"}, k)
+	}
+	_, err = ParseKey("energy/12345/7E1234AB-12")
+	assert.Error(t, err, "energy checkpoints shouldn't have serials")
+	_, err = ParseKey("telemetry/12345")
+	assert.Error(t, err, "telemetry checkpoints should have serials")
+	_, err = ParseKey("solaredge-monitoring-checkpoint")
+	assert.Error(t, err)
+
+	legacy, err := Parse("2021-11-01 10:15:00")
+	if assert.NoError(t, err) {
+		assert.True(t, time.Date(2021, 11, 1, 10, 15, 0, 0, time.UTC).Equal(legacy))
+	}
+}
+
+// fakeDynamoDB keeps items by id, and understands the conditions DynamoDBStore uses.
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func newFakeDynamoDB() *fakeDynamoDB {
+	return &fakeDynamoDB{items: map[string]map[string]*dynamodb.AttributeValue{}}
+}
+
+func (f *fakeDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.items[*input.Key[dynamoKeyAttribute].S]}, nil
+}
+
+func (f *fakeDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	id := *input.Item[dynamoKeyAttribute].S
+	current, exists := f.items[id][dynamoTimeAttribute]
+	failed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "the conditional request failed", nil)
+	switch aws.StringValue(input.ConditionExpression) {
+	case "":
+	case "attribute_not_exists(#checkpoint)":
+		if exists {
+			return nil, failed
+		}
+	case "#checkpoint = :previous":
+		if !exists || *current.S != *input.ExpressionAttributeValues[":previous"].S {
+			return nil, failed
+		}
+	default:
+		panic("unexpected condition " + *input.ConditionExpression)
+	}
+	f.items[id] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	delete(f.items, *input.Key[dynamoKeyAttribute].S)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) ScanPages(input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	page := &dynamodb.ScanOutput{}
+	for _, item := range f.items {
+		page.Items = append(page.Items, item)
+	}
+	fn(page, true)
+	return nil
+}
+
+// testStore runs a store through what the collectors and the checkpoints command do with it.
+func testStore(t *testing.T, store Store) {
+	energy := Key{Action: ActionEnergy, SiteID: "12345"}
+	inverterA := Key{Action: ActionTelemetry, SiteID: "12345", Serial: "A"}
+	inverterB := Key{Action: ActionTelemetry, SiteID: "12345", Serial: "B"}
+
+	last, err := store.Get(energy)
+	assert.NoError(t, err)
+	assert.True(t, last.IsZero(), "a missing checkpoint should be the zero time")
+
+	sydney, _ := time.LoadLocation("Australia/Sydney")
+	first := time.Date(2021, 11, 1, 10, 15, 0, 0, sydney)
+	assert.NoError(t, store.Advance(energy, time.Time{}, first))
+	assert.NoError(t, store.Advance(inverterA, time.Time{}, first))
+	assert.NoError(t, store.Set(inverterB, first.Add(time.Hour)))
+
+	last, err = store.Get(energy)
+	assert.NoError(t, err)
+	assert.True(t, first.Equal(last))
+
+	assert.ErrorIs(t, store.Advance(energy, time.Time{}, first.Add(time.Hour)), ErrConflict, "a checkpoint that's been written shouldn't be created again")
+	assert.NoError(t, store.Advance(energy, last, first.Add(time.Hour)))
+	assert.ErrorIs(t, store.Advance(energy, last, first.Add(2*time.Hour)), ErrConflict, "a run that read an old checkpoint shouldn't move it")
+
+	checkpoints, err := store.List()
+	if assert.NoError(t, err) && assert.Len(t, checkpoints, 3) {
+		assert.Equal(t, energy, checkpoints[0].Key)
+		assert.True(t, first.Add(time.Hour).Equal(checkpoints[0].Time))
+		assert.Equal(t, inverterA, checkpoints[1].Key)
+		assert.True(t, first.Equal(checkpoints[1].Time), "each inverter should keep its own checkpoint")
+		assert.Equal(t, inverterB, checkpoints[2].Key)
+	}
+
+	assert.NoError(t, store.Delete(inverterA))
+	last, err = store.Get(inverterA)
+	assert.NoError(t, err)
+	assert.True(t, last.IsZero())
+	last, err = store.Get(inverterB)
+	assert.NoError(t, err)
+	assert.False(t, last.IsZero(), "resetting one inverter shouldn't touch another")
+
+	assert.Error(t, store.Set(Key{Action: ActionEnergy}, first), "keys without a site should be refused")
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "checkpoints.json")
+	testStore(t, NewFileStore(path))
+
+	store, err := Open("file://" + path)
+	if assert.NoError(t, err) {
+		checkpoints, err := store.List()
+		assert.NoError(t, err)
+		assert.Len(t, checkpoints, 2, "checkpoints should outlive the store that wrote them")
+	}
+	_, err = os.Stat(path + ".lock")
+	assert.True(t, os.IsNotExist(err), "the lock should be gone once the store's done")
+}
+
+func TestS3Store(t *testing.T) {
+	fake := newFakeS3()
+	fake.objects["collector/checkpoints/README"] = []byte("not a checkpoint")
+	testStore(t, NewS3Store(fake, "bucket", "collector"))
+	assert.Contains(t, fake.objects, "collector/checkpoints/energy/12345")
+
+	legacy, err := Legacy(NewS3Store(fake, "bucket", "collector"))
+	if assert.NoError(t, err) {
+		assert.True(t, legacy.IsZero(), "a bucket that never had the old checkpoint should have no legacy")
+	}
+	fake.objects["collector/"+LegacyKey] = []byte("2021-11-01 10:15:00")
+	fake.objects["/"+LegacyKey] = []byte("2021-10-01 00:00:00")
+	for prefix, expected := range map[string]time.Time{
+		"collector": time.Date(2021, 11, 1, 10, 15, 0, 0, time.UTC),
+		"":          time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		legacy, err := Legacy(NewS3Store(fake, "bucket", prefix))
+		if assert.NoError(t, err) {
+			assert.True(t, expected.Equal(legacy), "prefix %q: legacy checkpoint should be %s, not %s", prefix, expected, legacy)
+		}
+	}
+
+	legacy, err = Legacy(NewMemoryStore())
+	if assert.NoError(t, err) {
+		assert.True(t, legacy.IsZero())
+	}
+}
+
+func TestDynamoDBStore(t *testing.T) {
+	fake := newFakeDynamoDB()
+	fake.items["other/energy/12345"] = map[string]*dynamodb.AttributeValue{
+		dynamoKeyAttribute:  {S: aws.String("other/energy/12345")},
+		dynamoTimeAttribute: {S: aws.String("2021-11-01T00:00:00Z")},
+	}
+	testStore(t, NewDynamoDBStore(fake, "checkpoints", "collector"))
+	assert.Contains(t, fake.items, "collector/energy/12345")
+}
+
+func TestBuffer(t *testing.T) {
+	store := NewMemoryStore()
+	energy := Key{Action: ActionEnergy, SiteID: "12345"}
+	telemetry := Key{Action: ActionTelemetry, SiteID: "12345", Serial: "7E1234AB-12"}
+	day := time.Date(2021, 11, 2, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.Set(telemetry, day))
+
+	buffer := NewBuffer(store)
+	assert.NoError(t, buffer.Advance(energy, time.Time{}, day))
+	assert.NoError(t, buffer.Advance(energy, day, day.Add(time.Hour)))
+	assert.NoError(t, buffer.Advance(telemetry, day, day.Add(time.Hour)))
+	assert.ErrorIs(t, buffer.Advance(energy, day, day.Add(2*time.Hour)), ErrConflict)
+
+	last, err := buffer.Get(energy)
+	assert.NoError(t, err)
+	assert.True(t, day.Add(time.Hour).Equal(last), "the buffer should see its own advances")
+	last, err = store.Get(energy)
+	assert.NoError(t, err)
+	assert.True(t, last.IsZero(), "nothing should reach the store before Commit")
+
+	// something else moves the telemetry checkpoint meanwhile.
+	assert.NoError(t, store.Set(telemetry, day.Add(3*time.Hour)))
+	err = buffer.Commit()
+	assert.ErrorIs(t, err, ErrConflict)
+
+	last, err = store.Get(energy)
+	assert.NoError(t, err)
+	assert.True(t, day.Add(time.Hour).Equal(last), "a conflict shouldn't stop the other advances")
+	last, err = store.Get(telemetry)
+	assert.NoError(t, err)
+	assert.True(t, day.Add(3*time.Hour).Equal(last))
+	assert.NoError(t, buffer.Commit(), "committed advances shouldn't be made again")
+}
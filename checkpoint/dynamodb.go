@@ -0,0 +1,170 @@
+package checkpoint
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// dynamoKeyAttribute is the table's partition key, a string.
+	dynamoKeyAttribute = "id"
+	// dynamoTimeAttribute holds the checkpoint itself.
+	dynamoTimeAttribute = "checkpoint"
+)
+
+// DynamoDBStore keeps a checkpoint per item, in a table with a string partition key called id.
+// Advance is a conditional write, so two invocations working on the same site can't clobber each
+// other; the loser gets ErrConflict.
+type DynamoDBStore struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+	prefix string
+}
+
+// NewDynamoDBStore keeps checkpoints in table, with ids starting with prefix, so one table can be
+// shared between collectors.
+func NewDynamoDBStore(client dynamodbiface.DynamoDBAPI, table, prefix string) *DynamoDBStore {
+	if prefix != "" {
+		prefix = strings.Trim(prefix, "/") + "/"
+	}
+	return &DynamoDBStore{client: client, table: table, prefix: prefix}
+}
+
+func (d *DynamoDBStore) id(k Key) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		dynamoKeyAttribute: {S: aws.String(d.prefix + k.String())},
+	}
+}
+
+func (d *DynamoDBStore) Get(k Key) (time.Time, error) {
+	if err := k.Validate(); err != nil {
+		return time.Time{}, err
+	}
+	output, err := d.client.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(d.table),
+		Key:            d.id(k),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to get checkpoint %s: %w", k, err)
+	}
+	return d.parse(k, output.Item)
+}
+
+func (d *DynamoDBStore) parse(k Key, item map[string]*dynamodb.AttributeValue) (time.Time, error) {
+	value, ok := item[dynamoTimeAttribute]
+	if !ok || value.S == nil {
+		return time.Time{}, nil
+	}
+	t, err := Parse(*value.S)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("checkpoint %s is unreadable: %w", k, err)
+	}
+	return t, nil
+}
+
+func (d *DynamoDBStore) item(k Key, t time.Time) map[string]*dynamodb.AttributeValue {
+	item := d.id(k)
+	item[dynamoTimeAttribute] = &dynamodb.AttributeValue{S: aws.String(Format(t))}
+	return item
+}
+
+func (d *DynamoDBStore) Advance(k Key, previous, t time.Time) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		TableName:                aws.String(d.table),
+		Item:                     d.item(k, t),
+		ExpressionAttributeNames: map[string]*string{"#checkpoint": aws.String(dynamoTimeAttribute)},
+	}
+	if previous.IsZero() {
+		input.ConditionExpression = aws.String("attribute_not_exists(#checkpoint)")
+	} else {
+		input.ConditionExpression = aws.String("#checkpoint = :previous")
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":previous": {S: aws.String(Format(previous))},
+		}
+	}
+
+	_, err := d.client.PutItem(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return fmt.Errorf("%s isn't at %s any more: %w", k, Format(previous), ErrConflict)
+		}
+		return fmt.Errorf("unable to advance checkpoint %s: %w", k, err)
+	}
+	return nil
+}
+
+func (d *DynamoDBStore) Set(k Key, t time.Time) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	_, err := d.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(d.table),
+		Item:      d.item(k, t),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set checkpoint %s: %w", k, err)
+	}
+	return nil
+}
+
+func (d *DynamoDBStore) Delete(k Key) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	_, err := d.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(d.table),
+		Key:       d.id(k),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete checkpoint %s: %w", k, err)
+	}
+	return nil
+}
+
+// List scans the table, so it's for the occasional look rather than every run.
+func (d *DynamoDBStore) List() ([]Checkpoint, error) {
+	var checkpoints []Checkpoint
+	var parseErr error
+	err := d.client.ScanPages(&dynamodb.ScanInput{
+		TableName:      aws.String(d.table),
+		ConsistentRead: aws.Bool(true),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			id, ok := item[dynamoKeyAttribute]
+			if !ok || id.S == nil || !strings.HasPrefix(*id.S, d.prefix) {
+				continue
+			}
+			k, err := ParseKey(strings.TrimPrefix(*id.S, d.prefix))
+			if err != nil {
+				log.Warn().Err(err).Str("id", *id.S).Msg("skipping item that isn't a checkpoint")
+				continue
+			}
+			t, err := d.parse(k, item)
+			if err != nil {
+				parseErr = err
+				return false
+			}
+			checkpoints = append(checkpoints, Checkpoint{Key: k, Time: t})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list checkpoints: %w", err)
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	sortCheckpoints(checkpoints)
+	return checkpoints, nil
+}
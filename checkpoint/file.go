@@ -0,0 +1,208 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// lockTimeout is how long to wait for another run to finish with the file.
+	lockTimeout = 10 * time.Second
+	// staleLock is how old a lock has to be before it's taken to be left over from a run that
+	// crashed.
+	staleLock = time.Minute
+)
+
+// FileStore keeps checkpoints in a JSON file, for running the collector on a home server. Runs
+// take turns with a lock file next to it, so Advance is as safe as it is on DynamoDB.
+type FileStore struct {
+	path string
+}
+
+type checkpointFile struct {
+	Checkpoints map[string]string `json:"checkpoints"`
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (f *FileStore) Get(k Key) (time.Time, error) {
+	if err := k.Validate(); err != nil {
+		return time.Time{}, err
+	}
+	file, err := f.load()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return f.parse(k, file.Checkpoints[k.String()])
+}
+
+func (f *FileStore) Advance(k Key, previous, t time.Time) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	return f.update(func(file *checkpointFile) error {
+		current, err := f.parse(k, file.Checkpoints[k.String()])
+		if err != nil {
+			return err
+		}
+		if !current.Equal(previous) {
+			return fmt.Errorf("%s is at %s, not %s: %w", k, Format(current), Format(previous), ErrConflict)
+		}
+		file.Checkpoints[k.String()] = Format(t)
+		return nil
+	})
+}
+
+func (f *FileStore) Set(k Key, t time.Time) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	return f.update(func(file *checkpointFile) error {
+		file.Checkpoints[k.String()] = Format(t)
+		return nil
+	})
+}
+
+func (f *FileStore) Delete(k Key) error {
+	return f.update(func(file *checkpointFile) error {
+		delete(file.Checkpoints, k.String())
+		return nil
+	})
+}
+
+func (f *FileStore) List() ([]Checkpoint, error) {
+	file, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := make([]Checkpoint, 0, len(file.Checkpoints))
+	for name, stamp := range file.Checkpoints {
+		k, err := ParseKey(name)
+		if err != nil {
+			log.Warn().Err(err).Str("path", f.path).Msg("skipping entry that isn't a checkpoint")
+			continue
+		}
+		t, err := f.parse(k, stamp)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, Checkpoint{Key: k, Time: t})
+	}
+	sortCheckpoints(checkpoints)
+	return checkpoints, nil
+}
+
+func (f *FileStore) parse(k Key, stamp string) (time.Time, error) {
+	if stamp == "" {
+		return time.Time{}, nil
+	}
+	t, err := Parse(stamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("checkpoint %s in %s is unreadable: %w", k, f.path, err)
+	}
+	return t, nil
+}
+
+// load reads the file; a missing file has no checkpoints.
+func (f *FileStore) load() (*checkpointFile, error) {
+	file := &checkpointFile{Checkpoints: make(map[string]string)}
+
+	data, err := ioutil.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return file, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read checkpoints %s: %w", f.path, err)
+	}
+
+	err = json.Unmarshal(data, file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse checkpoints %s: %w", f.path, err)
+	}
+	if file.Checkpoints == nil {
+		file.Checkpoints = make(map[string]string)
+	}
+	return file, nil
+}
+
+// update changes the file under the lock, writing it through a temporary file so an interrupted
+// save can't lose it.
+func (f *FileStore) update(change func(file *checkpointFile) error) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := f.load()
+	if err != nil {
+		return err
+	}
+	err = change(file)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to save checkpoints %s: %w", f.path, err)
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to save checkpoints %s: %w", f.path, err)
+	}
+	err = os.Rename(temp.Name(), f.path)
+	if err != nil {
+		return fmt.Errorf("unable to save checkpoints %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// lock creates the lock file, waiting for another run to remove it, or for it to go stale.
+func (f *FileStore) lock() (func(), error) {
+	err := os.MkdirAll(filepath.Dir(f.path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create directory for %s: %w", f.path, err)
+	}
+
+	lockPath := f.path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			lockFile.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("unable to lock checkpoints %s: %w", f.path, err)
+		}
+
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > staleLock {
+			log.Warn().Str("lock", lockPath).Msg("removing stale checkpoint lock")
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,67 @@
+package checkpoint
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps checkpoints for as long as the process runs, for tests and one-off runs.
+type MemoryStore struct {
+	lock        sync.Mutex
+	checkpoints map[Key]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{checkpoints: make(map[Key]time.Time)}
+}
+
+func (m *MemoryStore) Get(k Key) (time.Time, error) {
+	if err := k.Validate(); err != nil {
+		return time.Time{}, err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.checkpoints[k], nil
+}
+
+func (m *MemoryStore) Advance(k Key, previous, t time.Time) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if current := m.checkpoints[k]; !current.Equal(previous) {
+		return fmt.Errorf("%s is at %s, not %s: %w", k, Format(current), Format(previous), ErrConflict)
+	}
+	m.checkpoints[k] = t
+	return nil
+}
+
+func (m *MemoryStore) Set(k Key, t time.Time) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.checkpoints[k] = t
+	return nil
+}
+
+func (m *MemoryStore) Delete(k Key) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.checkpoints, k)
+	return nil
+}
+
+func (m *MemoryStore) List() ([]Checkpoint, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	checkpoints := make([]Checkpoint, 0, len(m.checkpoints))
+	for k, t := range m.checkpoints {
+		checkpoints = append(checkpoints, Checkpoint{Key: k, Time: t})
+	}
+	sortCheckpoints(checkpoints)
+	return checkpoints, nil
+}
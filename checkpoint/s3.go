@@ -0,0 +1,167 @@
+package checkpoint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/rs/zerolog/log"
+)
+
+// S3Store keeps each checkpoint as a small object under <prefix>/checkpoints/. S3 has no
+// conditional puts here, so Advance checks and writes separately; two runs at once can still race,
+// which is what DynamoDBStore is for.
+type S3Store struct {
+	client    s3iface.S3API
+	bucket    string
+	prefix    string
+	legacyKey string
+}
+
+func NewS3Store(client s3iface.S3API, bucket, prefix string) *S3Store {
+	return &S3Store{
+		client: client,
+		bucket: bucket,
+		prefix: strings.Trim(path.Join(prefix, "checkpoints"), "/") + "/",
+		// the old collector joined prefix and name with a slash, even when there was no prefix.
+		legacyKey: strings.Trim(prefix, "/") + "/" + LegacyKey,
+	}
+}
+
+// Legacy reads the single checkpoint the collector used to keep for every site, the zero time if
+// there isn't one.
+func (s *S3Store) Legacy() (time.Time, error) {
+	object, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.legacyKey),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("unable to get legacy checkpoint: %w", err)
+	}
+	defer object.Body.Close()
+
+	data, err := ioutil.ReadAll(object.Body)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to read legacy checkpoint: %w", err)
+	}
+	t, err := Parse(string(data))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("legacy checkpoint is unreadable: %w", err)
+	}
+	return t, nil
+}
+
+func (s *S3Store) objectKey(k Key) string {
+	return s.prefix + k.String()
+}
+
+func (s *S3Store) Get(k Key) (time.Time, error) {
+	if err := k.Validate(); err != nil {
+		return time.Time{}, err
+	}
+	object, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.objectKey(k)),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("unable to get checkpoint %s: %w", k, err)
+	}
+	defer object.Body.Close()
+
+	data, err := ioutil.ReadAll(object.Body)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to read checkpoint %s: %w", k, err)
+	}
+	t, err := Parse(string(data))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("checkpoint %s is unreadable: %w", k, err)
+	}
+	return t, nil
+}
+
+func (s *S3Store) Advance(k Key, previous, t time.Time) error {
+	current, err := s.Get(k)
+	if err != nil {
+		return err
+	}
+	if !current.Equal(previous) {
+		return fmt.Errorf("%s is at %s, not %s: %w", k, Format(current), Format(previous), ErrConflict)
+	}
+	return s.Set(k, t)
+}
+
+func (s *S3Store) Set(k Key, t time.Time) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.objectKey(k)),
+		Body:        strings.NewReader(Format(t)),
+		ContentType: aws.String("text/plain"),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set checkpoint %s: %w", k, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Delete(k Key) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.objectKey(k)),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete checkpoint %s: %w", k, err)
+	}
+	return nil
+}
+
+// List skips objects that don't look like checkpoints with a warning, rather than failing.
+func (s *S3Store) List() ([]Checkpoint, error) {
+	var keys []Key
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			name := strings.TrimPrefix(aws.StringValue(object.Key), s.prefix)
+			k, err := ParseKey(name)
+			if err != nil {
+				log.Warn().Err(err).Str("object", aws.StringValue(object.Key)).Msg("skipping object that isn't a checkpoint")
+				continue
+			}
+			keys = append(keys, k)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list checkpoints: %w", err)
+	}
+
+	checkpoints := make([]Checkpoint, 0, len(keys))
+	for _, k := range keys {
+		t, err := s.Get(k)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, Checkpoint{Key: k, Time: t})
+	}
+	sortCheckpoints(checkpoints)
+	return checkpoints, nil
+}
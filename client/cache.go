@@ -0,0 +1,205 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// CacheForever marks responses that will never change, like energy for days gone by.
+	CacheForever time.Duration = -1
+
+	staticDataTTL = 24 * time.Hour
+)
+
+// CacheTTLPolicy decides how long a response to the request may be served from the cache.
+// A zero duration means the response isn't cached at all.
+type CacheTTLPolicy func(req *http.Request, now time.Time) time.Duration
+
+// DefaultCacheTTL caches inventory and site details for a day, and windowed data that ended before
+// today forever. Anything touching today isn't cached: windows that end at "now" are never asked
+// for again, so their entries would only pile up.
+func DefaultCacheTTL(req *http.Request, now time.Time) time.Duration {
+	if req.Method != http.MethodGet {
+		return 0
+	}
+
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	switch {
+	case strings.HasSuffix(path, "/inventory"),
+		strings.HasSuffix(path, "/details"),
+		strings.HasSuffix(path, "/sites/list"):
+		return staticDataTTL
+	case strings.HasSuffix(path, "/energy"),
+		strings.HasSuffix(path, "/powerDetails"),
+		strings.HasSuffix(path, "/data"):
+		return windowTTL(req, now)
+	}
+
+	return 0
+}
+
+// windowTTL looks at where the queried window ends; once it's wholly before today it can't change.
+// The end time is site-local wall clock and we don't know the site's zone here, so "today" starts
+// a day early to stay on the safe side of any offset.
+func windowTTL(req *http.Request, now time.Time) time.Duration {
+	end, err := api.ParseTime(req.URL.Query().Get(endTimeParam))
+	if err != nil {
+		return 0
+	}
+
+	year, month, day := now.UTC().Date()
+	earliestToday := time.Date(year, month, day-1, 0, 0, 0, 0, time.UTC)
+	if end.Before(earliestToday) {
+		return CacheForever
+	}
+	return 0
+}
+
+type cacheEntry struct {
+	Key      string           `json:"key"`
+	StoredAt time.Time        `json:"storedAt"`
+	Response RecordedResponse `json:"response"`
+}
+
+// CachingRoundTripper serves repeat requests from disk, keyed on the request minus its API key,
+// so re-running a command over the same window doesn't spend the daily quota again.
+type CachingRoundTripper struct {
+	transport http.RoundTripper
+	dir       string
+	ttl       CacheTTLPolicy
+	now       func() time.Time
+}
+
+func NewCachingRoundTripper(dir string, transport http.RoundTripper) *CachingRoundTripper {
+	return &CachingRoundTripper{
+		transport: transport,
+		dir:       dir,
+		ttl:       DefaultCacheTTL,
+		now:       time.Now,
+	}
+}
+
+// DefaultCacheDir is where the CLI keeps its cache unless told otherwise.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "solaredge-monitoring"), nil
+}
+
+func (c *CachingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := c.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	now := c.now()
+	ttl := c.ttl(req, now)
+	if ttl == 0 {
+		return transport.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	log := log.With().Str("key", key).Logger()
+
+	entry, err := c.load(key)
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to read cache entry, ignoring it")
+	} else if entry != nil && (ttl == CacheForever || now.Sub(entry.StoredAt) < ttl) {
+		log.Debug().Time("storedAt", entry.StoredAt).Msg("serving response from cache")
+		return entry.Response.httpResponse(req), nil
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response body for caching: %w", err)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	err = c.store(&cacheEntry{
+		Key:      key,
+		StoredAt: now,
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       string(body),
+		},
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to write cache entry")
+	}
+
+	return resp, nil
+}
+
+// cacheKey identifies a request by endpoint and query parameters, leaving out the API key.
+func cacheKey(req *http.Request) string {
+	u := *req.URL
+	values := u.Query()
+	values.Del(apiKeyParam)
+	u.RawQuery = values.Encode()
+	return req.Method + " " + u.String()
+}
+
+func (c *CachingRoundTripper) entryPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *CachingRoundTripper) load(key string) (*cacheEntry, error) {
+	data, err := ioutil.ReadFile(c.entryPath(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entry cacheEntry
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse cache entry: %w", err)
+	}
+	if entry.Key != key {
+		// hash collision, or somebody's been editing files; either way it's not ours.
+		return nil, nil
+	}
+
+	return &entry, nil
+}
+
+func (c *CachingRoundTripper) store(entry *cacheEntry) error {
+	err := os.MkdirAll(c.dir, 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create cache directory %s: %w", c.dir, err)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(c.entryPath(entry.Key), data, 0644)
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	detailsResponse = `{"details":{"id":12345,"location":{"timeZone":"America/Los_Angeles"}}}`
+	energyResponse  = `{"energy":{"timeUnit":"DAY","unit":"Wh","values":[{"date":"2021-11-01 00:00:00","value":1234}]}}`
+)
+
+func TestCachingRoundTripper(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/details") {
+			w.Write([]byte(detailsResponse))
+			return
+		}
+		hits++
+		w.Write([]byte(energyResponse))
+	}))
+	defer server.Close()
+
+	now := time.Date(2021, 12, 10, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	cache := NewCachingRoundTripper(dir, nil)
+	cache.now = func() time.Time { return now }
+
+	c := NewClient("secret-key", WithBaseURL(server.URL), WithTransport(cache))
+	otherKey := NewClient("other-key", WithBaseURL(server.URL), WithTransport(cache))
+
+	lastWeek := now.Add(-7 * 24 * time.Hour)
+	past := lastWeek.Add(-24 * time.Hour)
+
+	_, err := c.GetEnergyUsage("12345", api.TimeUnitDay, past, lastWeek)
+	assert.NoError(t, err)
+	_, err = otherKey.GetEnergyUsage("12345", api.TimeUnitDay, past, lastWeek)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hits, "past windows should be served from cache regardless of api key")
+
+	now = now.Add(365 * 24 * time.Hour)
+	_, err = c.GetEnergyUsage("12345", api.TimeUnitDay, past, lastWeek)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hits, "past windows should be cached forever")
+
+	today := now.Add(-time.Hour)
+	_, err = c.GetEnergyUsage("12345", api.TimeUnitDay, lastWeek, today)
+	assert.NoError(t, err)
+	_, err = c.GetEnergyUsage("12345", api.TimeUnitDay, lastWeek, today)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, hits, "today's data should always come from the API")
+
+	entries, err := ioutil.ReadDir(dir)
+	if assert.NoError(t, err) {
+		assert.Len(t, entries, 2, "only the site details and the past window should have been cached")
+	}
+}
+
+func TestDefaultCacheTTL(t *testing.T) {
+	now := time.Date(2021, 12, 1, 12, 0, 0, 0, time.UTC)
+
+	for path, expected := range map[string]time.Duration{
+		"/site/12345/inventory": staticDataTTL,
+		"/site/12345/details":   staticDataTTL,
+		"/sites/list":           staticDataTTL,
+		"/site/12345/overview":  0,
+	} {
+		req := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: path}}
+		assert.Equal(t, expected, DefaultCacheTTL(req, now), "unexpected TTL for %s", path)
+	}
+}
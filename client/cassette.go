@@ -0,0 +1,199 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	apiKeyParam    = "api_key"
+	redactedAPIKey = "REDACTED"
+)
+
+// Cassette is an on-disk record of API interactions, so that real responses can be replayed
+// later without spending any quota.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+func (r RecordedResponse) httpResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(r.Body))),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cassette %s: %w", path, err)
+	}
+
+	var cassette Cassette
+	err = json.Unmarshal(data, &cassette)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse cassette %s: %w", path, err)
+	}
+
+	return &cassette, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal cassette: %w", err)
+	}
+
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write cassette %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// redactURL strips the API key out of a request URL so it never lands on disk, and so that
+// recordings match regardless of which key replays them, even none at all.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	values := redacted.Query()
+	if values.Has(apiKeyParam) {
+		values.Set(apiKeyParam, redactedAPIKey)
+	}
+	redacted.RawQuery = values.Encode()
+	return redacted.String()
+}
+
+// RecordingRoundTripper passes requests through to the real transport and writes every
+// interaction to the cassette file as it happens.
+type RecordingRoundTripper struct {
+	transport http.RoundTripper
+	path      string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+func NewRecordingRoundTripper(path string, transport http.RoundTripper) *RecordingRoundTripper {
+	return &RecordingRoundTripper{
+		transport: transport,
+		path:      path,
+	}
+}
+
+func (r *RecordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := r.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response body for recording: %w", err)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    redactURL(req.URL),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       string(body),
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	log.Debug().Str("url", interaction.Request.URL).Str("cassette", r.path).Msg("recorded interaction")
+
+	err = r.cassette.Save(r.path)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// ReplayingRoundTripper answers requests from a cassette and never touches the network.
+// Repeated requests for the same URL are answered in the order they were recorded.
+type ReplayingRoundTripper struct {
+	mu        sync.Mutex
+	responses map[string][]RecordedResponse
+}
+
+func NewReplayingRoundTripper(path string) (*ReplayingRoundTripper, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(map[string][]RecordedResponse)
+	for _, interaction := range cassette.Interactions {
+		key := replayKey(interaction.Request.Method, interaction.Request.URL)
+		responses[key] = append(responses[key], interaction.Response)
+	}
+
+	return &ReplayingRoundTripper{responses: responses}, nil
+}
+
+func replayKey(method, url string) string {
+	return method + " " + url
+}
+
+func (r *ReplayingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := replayKey(req.Method, redactURL(req.URL))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recorded, ok := r.responses[key]
+	if !ok || len(recorded) == 0 {
+		return nil, fmt.Errorf("no recorded interaction for %s", key)
+	}
+	r.responses[key] = recorded[1:]
+
+	log.Debug().Str("request", key).Msg("replaying interaction")
+
+	return recorded[0].httpResponse(req), nil
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const inventoryResponse = `{"Inventory":{"inverters":[{"name":"Inverter 1","SN":"7E1234AB-12"}]}}`
+
+func TestRecordAndReplay(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		assert.Equal(t, "secret-key", r.URL.Query().Get("api_key"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(inventoryResponse))
+	}))
+	defer server.Close()
+
+	cassettePath := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder := NewClient("secret-key", WithBaseURL(server.URL), WithTransport(NewRecordingRoundTripper(cassettePath, nil)))
+	recorded, err := recorder.GetSiteInventory("12345")
+	if !assert.NoError(t, err, "recording request failed") {
+		return
+	}
+	assert.Equal(t, 1, hits)
+
+	data, err := ioutil.ReadFile(cassettePath)
+	if assert.NoError(t, err, "cassette was not written") {
+		assert.False(t, strings.Contains(string(data), "secret-key"), "cassette should not contain the api key")
+	}
+
+	replayer, err := NewReplayingRoundTripper(cassettePath)
+	if !assert.NoError(t, err, "unable to load cassette") {
+		return
+	}
+
+	replay := NewClient("some-other-key", WithBaseURL(server.URL), WithTransport(replayer))
+	replayed, err := replay.GetSiteInventory("12345")
+	assert.NoError(t, err, "replayed request failed")
+	assert.Equal(t, 1, hits, "replay should not hit the server")
+	assert.Equal(t, recorded, replayed)
+
+	// --replay doesn't need an API key, which leaves api_key empty rather than missing.
+	replayer, err = NewReplayingRoundTripper(cassettePath)
+	if !assert.NoError(t, err, "unable to load cassette") {
+		return
+	}
+	keyless := NewClient("", WithBaseURL(server.URL), WithTransport(replayer))
+	replayed, err = keyless.GetSiteInventory("12345")
+	if assert.NoError(t, err, "replay without an API key failed") {
+		assert.Equal(t, recorded, replayed)
+	}
+
+	_, err = replay.GetSiteInventory("12345")
+	assert.Error(t, err, "each recorded interaction should only replay once")
+
+	_, err = replay.GetSiteInventory("67890")
+	assert.Error(t, err, "unrecorded requests should fail")
+}
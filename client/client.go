@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -17,12 +19,44 @@ const defaultBaseURL = "https://monitoringapi.solaredge.com"
 type Client struct {
 	client  http.Client
 	baseURL url.URL
+
+	locationsLock sync.Mutex
+	locations     map[string]*time.Location
+}
+
+// Option adjusts how a Client is constructed.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	baseURL   string
+	transport http.RoundTripper
+}
+
+// WithBaseURL points the client at something other than the public monitoring API.
+func WithBaseURL(baseURL string) Option {
+	return func(o *clientOptions) {
+		o.baseURL = baseURL
+	}
+}
+
+// WithTransport sets the transport that sits underneath the API key injection.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *clientOptions) {
+		o.transport = transport
+	}
 }
 
-func NewClient(key string) *Client {
-	log.Debug().Str("baseURL", defaultBaseURL).Msg("Setting up client")
+func NewClient(key string, opts ...Option) *Client {
+	options := clientOptions{
+		baseURL: defaultBaseURL,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	log.Debug().Str("baseURL", options.baseURL).Msg("Setting up client")
 
-	baseURL, err := url.Parse(defaultBaseURL)
+	baseURL, err := url.Parse(options.baseURL)
 	if err != nil {
 		panic(err)
 	}
@@ -30,10 +64,12 @@ func NewClient(key string) *Client {
 	client := &Client{
 		client: http.Client{
 			Transport: AuthenticatingRoundTripper{
-				key: key,
+				transport: options.transport,
+				key:       key,
 			},
 		},
-		baseURL: *baseURL,
+		baseURL:   *baseURL,
+		locations: make(map[string]*time.Location),
 	}
 
 	return client
@@ -10,15 +10,26 @@ import (
 const energyUsageEndpointTemplate = "site/%s/energy"
 
 func (c *Client) GetEnergyUsage(siteID, timeUnit string, startTime, endTime time.Time) (*api.Energy, error) {
-	result := &api.Energy{}
+	result := &api.EnergyDocument{}
+
+	loc, err := c.SiteLocation(siteID)
+	if err != nil {
+		return nil, err
+	}
 
 	req := c.CreateRequest(fmt.Sprintf(energyUsageEndpointTemplate, siteID))
-	req.SetTimeParams(timeUnit, startTime, endTime)
+	req.SetTimeParams(timeUnit, startTime.In(loc), endTime.In(loc))
 
 	resp, err := c.do(c.client.Get, req)
 	if err != nil {
 		return nil, fmt.Errorf("unable to list sites: %w", err)
 	}
 
-	return result, handleResponse(resp, result)
+	err = handleResponse(resp, result)
+	if err != nil {
+		return nil, err
+	}
+	result.Energy.SetLocation(loc)
+
+	return &result.Energy, nil
 }
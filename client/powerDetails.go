@@ -0,0 +1,45 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+)
+
+const (
+	powerDetailsEndpointTemplate = "site/%s/powerDetails"
+	metersParam                  = "meters"
+)
+
+// GetPowerDetails gets quarter-hour average power per meter; meters defaults to all of them. The API
+// allows a month at a time.
+func (c *Client) GetPowerDetails(siteID string, startTime, endTime time.Time, meters ...string) (*api.PowerDetails, error) {
+	result := &api.PowerDetailsDocument{}
+
+	loc, err := c.SiteLocation(siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	req := c.CreateRequestf(powerDetailsEndpointTemplate, siteID)
+	req.SetTimeParam(startTimeParam, startTime.In(loc)).
+		SetTimeParam(endTimeParam, endTime.In(loc))
+	if len(meters) > 0 {
+		req.SetParam(metersParam, strings.Join(meters, ","))
+	}
+
+	resp, err := c.do(c.client.Get, req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get power details: %w", err)
+	}
+
+	err = handleResponse(resp, result)
+	if err != nil {
+		return nil, err
+	}
+	result.PowerDetails.SetLocation(loc)
+
+	return &result.PowerDetails, nil
+}
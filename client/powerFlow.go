@@ -0,0 +1,27 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+)
+
+const (
+	// expects siteID
+	currentPowerFlowEndpointTemplate = "site/%s/currentPowerFlow"
+)
+
+func (c *Client) GetCurrentPowerFlow(siteID string) (*api.PowerFlow, error) {
+
+	result := &api.PowerFlowDocument{}
+
+	req := c.CreateRequestf(currentPowerFlowEndpointTemplate, siteID)
+
+	resp, err := c.do(c.client.Get, req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get current power flow: %w", err)
+	}
+
+	return &result.PowerFlow, handleResponse(resp, result)
+
+}
@@ -2,11 +2,17 @@ package client
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/rs/zerolog/log"
 )
 
-const siteListEndpoint = "/sites/list"
+const (
+	siteListEndpoint = "/sites/list"
+	// expects siteID
+	siteDetailsEndpointTemplate = "site/%s/details"
+)
 
 func (c *Client) GetSiteList() ([]api.SiteDetails, error) {
 	var result api.SiteListDocument
@@ -18,5 +24,67 @@ func (c *Client) GetSiteList() ([]api.SiteDetails, error) {
 		return nil, fmt.Errorf("unable to list sites: %w", err)
 	}
 
-	return result.Sites.Sites, handleResponse(response, &result)
+	err = handleResponse(response, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range result.Sites.Sites {
+		site := &result.Sites.Sites[i]
+		loc, err := site.Location.TimeLocation()
+		if err != nil {
+			return nil, fmt.Errorf("site %d: %w", site.ID, err)
+		}
+		site.SetLocation(loc)
+	}
+
+	return result.Sites.Sites, nil
+}
+
+func (c *Client) GetSiteDetails(siteID string) (*api.SiteDetails, error) {
+	var result api.SiteDetailsDocument
+
+	req := c.CreateRequestf(siteDetailsEndpointTemplate, siteID)
+
+	response, err := c.do(c.client.Get, req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get site details: %w", err)
+	}
+
+	err = handleResponse(response, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := result.Details.Location.TimeLocation()
+	if err != nil {
+		return nil, fmt.Errorf("site %s: %w", siteID, err)
+	}
+	result.Details.SetLocation(loc)
+
+	return &result.Details, nil
+}
+
+// SiteLocation returns the zone the site reports its times in. It's looked up once per client.
+func (c *Client) SiteLocation(siteID string) (*time.Location, error) {
+	c.locationsLock.Lock()
+	defer c.locationsLock.Unlock()
+
+	if loc, ok := c.locations[siteID]; ok {
+		return loc, nil
+	}
+
+	details, err := c.GetSiteDetails(siteID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up time zone for site %s: %w", siteID, err)
+	}
+
+	loc, err := details.Location.TimeLocation()
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Str("siteid", siteID).Str("location", loc.String()).Msg("found site time zone")
+
+	c.locations[siteID] = loc
+	return loc, nil
 }
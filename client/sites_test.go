@@ -0,0 +1,51 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSiteLocalTimes(t *testing.T) {
+	var energyQuery map[string]string
+	var detailsHits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/details") {
+			detailsHits++
+			w.Write([]byte(detailsResponse))
+			return
+		}
+		energyQuery = map[string]string{
+			startTimeParam: r.URL.Query().Get(startTimeParam),
+			endTimeParam:   r.URL.Query().Get(endTimeParam),
+		}
+		w.Write([]byte(energyResponse))
+	}))
+	defer server.Close()
+
+	c := NewClient("secret-key", WithBaseURL(server.URL))
+
+	start := time.Date(2021, 11, 1, 7, 0, 0, 0, time.UTC)
+	energy, err := c.GetEnergyUsage("12345", api.TimeUnitDay, start, start.Add(24*time.Hour))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "2021-11-01 00:00:00", energyQuery[startTimeParam], "start time should be rendered in the site's zone")
+	assert.Equal(t, "2021-11-02 00:00:00", energyQuery[endTimeParam], "end time should be rendered in the site's zone")
+
+	if assert.Len(t, energy.Values, 1) {
+		date := energy.Values[0].Date
+		assert.Equal(t, "America/Los_Angeles", date.Location().String())
+		assert.Equal(t, "2021-11-01T00:00:00-07:00", date.Format(time.RFC3339))
+	}
+
+	_, err = c.GetEnergyUsage("12345", api.TimeUnitDay, start, start.Add(24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, detailsHits, "site zone should only be looked up once")
+}
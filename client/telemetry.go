@@ -13,15 +13,26 @@ const equipmentDataEndpointTemplate = "equipment/%s/%s/data"
 func (c *Client) GetTelemetryForEquipment(siteID, serialNumber string, timeUnit string, startTime, endTime time.Time) ([]api.Telemetry, error) {
 	var edd api.EquipmentDataDocument
 
+	loc, err := c.SiteLocation(siteID)
+	if err != nil {
+		return nil, err
+	}
+
 	req := c.CreateRequestf(equipmentDataEndpointTemplate, siteID, serialNumber)
-	req.SetTimeParams(timeUnit, startTime, endTime)
+	req.SetTimeParams(timeUnit, startTime.In(loc), endTime.In(loc))
 
 	resp, err := c.do(c.client.Get, req)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get telemetry: %w", err)
 	}
 
-	return edd.Data.Telemetries, handleResponse(resp, &edd)
+	err = handleResponse(resp, &edd)
+	if err != nil {
+		return nil, err
+	}
+	edd.Data.SetLocation(loc)
+
+	return edd.Data.Telemetries, nil
 }
 
 func (c *Client) GetTelemetryForAllInverters(siteID string, timeUnit string, startTime, endTime time.Time) (map[string][]api.Telemetry, error) {
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/checkpoint"
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var checkpointsCmd = &cobra.Command{
+	Use:   "checkpoints",
+	Short: "Inspect and reset the Lambda collector's checkpoints",
+	Long: `The Lambda collector, and get-energy and get-telemetry with --checkpoints, keep a checkpoint per site
+for energy and per inverter for telemetry. These commands show them, and move or reset them to fetch
+data again.`,
+}
+
+var checkpointsListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "Show every checkpoint and how far it's got",
+	Annotations: map[string]string{annotationNoAPIKey: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := getCheckpointStore()
+		if err != nil {
+			return err
+		}
+		checkpoints, err := store.List()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ACTION\tSITE\tSERIAL\tCHECKPOINT")
+		for _, c := range checkpoints {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Key.Action, c.Key.SiteID, c.Key.Serial, checkpoint.Format(c.Time))
+		}
+		return w.Flush()
+	},
+}
+
+var checkpointsResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset checkpoints, or move them to a given time",
+	Long: `Reset removes a site's energy checkpoint, or an inverter's telemetry checkpoint, so the next run
+starts from the collector's window again. Leave out the serial to reset every inverter at the site.
+With --to, the checkpoints are moved to that time instead, to refetch from there.`,
+	Annotations: map[string]string{annotationNoAPIKey: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var errs error
+		key := checkpoint.Key{
+			Action: viper.GetString("action"),
+			SiteID: viper.GetString("site-id"),
+			Serial: viper.GetString("serial"),
+		}
+		if key.Action != checkpoint.ActionEnergy && key.Action != checkpoint.ActionTelemetry {
+			errs = multierror.Append(errs, fmt.Errorf("action must be %s or %s", checkpoint.ActionEnergy, checkpoint.ActionTelemetry))
+		}
+		if key.SiteID == "" {
+			errs = multierror.Append(errs, errors.New("must specify a site-id"))
+		}
+		var to time.Time
+		if s := viper.GetString("to"); s != "" {
+			var err error
+			if to, err = api.ParseTimeIn(s, time.Local); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("to could not be parsed: %w", err))
+			}
+		}
+		if errs != nil {
+			return errs
+		}
+
+		store, err := getCheckpointStore()
+		if err != nil {
+			return err
+		}
+
+		keys := []checkpoint.Key{key}
+		if key.Action == checkpoint.ActionTelemetry && key.Serial == "" {
+			checkpoints, err := store.List()
+			if err != nil {
+				return err
+			}
+			keys = nil
+			for _, c := range checkpoints {
+				if c.Key.Action == key.Action && c.Key.SiteID == key.SiteID {
+					keys = append(keys, c.Key)
+				}
+			}
+			if len(keys) == 0 {
+				log.Info().Str("siteid", key.SiteID).Msg("no telemetry checkpoints for site")
+			}
+		}
+
+		for _, k := range keys {
+			if to.IsZero() {
+				err = store.Delete(k)
+			} else {
+				err = store.Set(k, to)
+			}
+			if err != nil {
+				errs = multierror.Append(errs, err)
+				continue
+			}
+			log.Info().Str("checkpoint", k.String()).Time("to", to).Msg("reset checkpoint")
+		}
+		return errs
+	},
+}
+
+func getCheckpointStore() (checkpoint.Store, error) {
+	checkpoints := viper.GetString("checkpoints")
+	if checkpoints == "" {
+		return nil, errors.New("must specify where the checkpoints are kept")
+	}
+	return checkpoint.Open(checkpoints)
+}
+
+// getIncrementalConfig is nil unless --checkpoints is set, in which case each site or inverter
+// picks up from its own checkpoint.
+func getIncrementalConfig(timeUnit string, start, end time.Time, discoverSites bool, siteIDs, serials []string) (*action.IncrementalConfig, checkpoint.Store, error) {
+	if viper.GetString("checkpoints") == "" {
+		return nil, nil, nil
+	}
+	store, err := getCheckpointStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &action.IncrementalConfig{
+		TimeUnit:      timeUnit,
+		StartTime:     start,
+		EndTime:       end,
+		DiscoverSites: discoverSites,
+		SiteIDs:       siteIDs,
+		SerialNumbers: serials,
+	}, store, nil
+}
+
+func addCheckpointFlags(cmd *cobra.Command, usage string) {
+	cmd.PersistentFlags().StringP("checkpoints", "", "", usage+" - a file, s3://bucket/prefix or dynamodb://table/prefix")
+}
+
+func init() {
+	RootCmd.AddCommand(checkpointsCmd)
+	checkpointsCmd.AddCommand(checkpointsListCmd)
+	checkpointsCmd.AddCommand(checkpointsResetCmd)
+
+	addCheckpointFlags(checkpointsCmd, "Where the checkpoints are kept")
+
+	checkpointsResetCmd.Flags().StringP("action", "", "", "Which checkpoints to reset: energy or telemetry")
+	checkpointsResetCmd.Flags().StringP("site-id", "", "", "Site whose checkpoints to reset")
+	checkpointsResetCmd.Flags().StringP("serial", "", "", "Inverter whose telemetry checkpoint to reset - will default to all of the site's inverters.")
+	checkpointsResetCmd.Flags().StringP("to", "", "", "Move the checkpoints to this local time rather than removing them")
+}
@@ -1,15 +1,14 @@
 package cmd
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"time"
 
 	"github.com/dreamlibrarian/solaredge-monitoring/action"
 	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/checkpoint"
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
 	"github.com/hashicorp/go-multierror"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -25,36 +24,27 @@ var energyCmd = &cobra.Command{
 			return err
 		}
 
-		action := action.NewEnergyAction(apiKey)
+		action := action.NewEnergyAction(apiKey, clientOptions...)
 
-		eMap, err := action.Do(config)
+		incremental, store, err := getIncrementalConfig(config.TimeUnit, config.StartTime, config.EndTime, config.DiscoverSites, config.SiteIDs, nil)
 		if err != nil {
 			return err
 		}
-
-		outputDir := viper.GetString("output-dir")
-		outputDirStat, err := os.Stat(outputDir)
-		if os.IsNotExist(err) {
-			err = os.Mkdir(outputDir, 0755)
-			if err != nil {
-				return fmt.Errorf("unable to create output directory %s: %w", outputDir, err)
-			}
-		} else if !outputDirStat.IsDir() {
-			return fmt.Errorf("path %s must refer to a directory", outputDir)
+		if incremental != nil {
+			// checkpoints only move once the output's closed, so nothing's skipped if that fails.
+			buffer := checkpoint.NewBuffer(store)
+			return streamOutput(series.FamilyEnergy, config.StartTime, config.EndTime, func(write func([]series.Series) error) error {
+				return action.Incremental(incremental, buffer, func(siteID string, energy *api.Energy) error {
+					return write([]series.Series{series.FromEnergy(siteID, energy)})
+				})
+			}, buffer.Commit)
 		}
 
-		for path, content := range eMap {
-			outputPath := fmt.Sprintf("%s/%s", outputDir, path)
-			data, err := json.Marshal(content)
-			if err != nil {
-				return err
-			}
-			err = ioutil.WriteFile(outputPath, data, 0644)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		return streamOutput(series.FamilyEnergy, config.StartTime, config.EndTime, func(write func([]series.Series) error) error {
+			return action.Stream(config, func(siteID string, energy *api.Energy) error {
+				return write([]series.Series{series.FromEnergy(siteID, energy)})
+			})
+		}, nil)
 	},
 }
 
@@ -66,7 +56,7 @@ func getEnergyConfig() (*action.EnergyConfig, error) {
 	if startTime == "" {
 		config.StartTime = time.Now().Add(-24 * time.Hour)
 	} else {
-		if config.StartTime, err = api.ParseTime(startTime); err != nil {
+		if config.StartTime, err = api.ParseTimeIn(startTime, time.Local); err != nil {
 			errs = multierror.Append(errs, fmt.Errorf("start time could not be parsed: %w", err))
 		}
 	}
@@ -75,8 +65,8 @@ func getEnergyConfig() (*action.EnergyConfig, error) {
 	if endTime == "" {
 		config.EndTime = time.Now()
 	} else {
-		if config.EndTime, err = api.ParseTime(endTime); err != nil {
-			errs = multierror.Append(errs, fmt.Errorf("start time could not be parsed: %w", err))
+		if config.EndTime, err = api.ParseTimeIn(endTime, time.Local); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("end time could not be parsed: %w", err))
 		}
 	}
 
@@ -109,15 +99,17 @@ func getEnergyConfig() (*action.EnergyConfig, error) {
 }
 
 func init() {
-	RootCmd.AddCommand(telemetryCmd)
+	RootCmd.AddCommand(energyCmd)
 
-	energyCmd.Flags().StringP("start-time", "", "", "Specify the start time for energy - will default to 24 hours ago.")
-	energyCmd.Flags().StringP("end-time", "", "", "Specify the start time for energy - will default to now.")
+	energyCmd.Flags().StringP("start-time", "", "", "Specify the start time for energy in local time - will default to 24 hours ago.")
+	energyCmd.Flags().StringP("end-time", "", "", "Specify the end time for energy in local time - will default to now.")
 	energyCmd.Flags().BoolP("by-hour", "", false, "Specify hourly samples")
 	energyCmd.Flags().BoolP("by-quarter-hour", "", false, "Specify 15-minute samples")
 	energyCmd.Flags().BoolP("by-day", "", false, "Specify daily samples")
 
 	energyCmd.Flags().StringSliceP("site-id", "", []string{}, "Specify site IDs; use multiple flags for multiple sites")
+	energyCmd.Flags().BoolP("all-sites", "", false, "Discover available sites and use them all")
 
-	energyCmd.Flags().StringP("output-dir", "", "", "Specify where output files belong")
+	addOutputFlags(energyCmd)
+	addCheckpointFlags(energyCmd, "Only fetch what's new since the last run, per site, with start-time for sites seen for the first time")
 }
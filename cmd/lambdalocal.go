@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/collector"
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	eventSQS      = "sqs"
+	eventSchedule = "schedule"
+
+	// localAPIKeySecret stands in for the Secrets Manager secret, since the key comes from the CLI.
+	localAPIKeySecret = "api-key"
+)
+
+var lambdaLocalCmd = &cobra.Command{
+	Use:   "lambda-local",
+	Short: "Run the Lambda collector here, against local storage",
+	Long: `Builds the SQS or EventBridge event the Lambda would be sent and runs the collector on it in-process,
+using the API key from here, and storage and checkpoints that can be directories and files. What the
+handler returns is printed; for SQS, any failed messages are listed as batch item failures.
+
+The rest of the collector's configuration is read from the environment, as the Lambda does.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var errs error
+
+		input := map[string]interface{}{}
+		if siteIDs := viper.GetStringSlice("site-id"); len(siteIDs) > 0 {
+			input["siteIds"] = siteIDs
+		}
+		if timeUnit := viper.GetString("time-unit"); timeUnit != "" {
+			input["timeUnit"] = timeUnit
+		}
+		if window := viper.GetString("window"); window != "" {
+			input["window"] = window
+		}
+		for flag, field := range map[string]string{"start-time": "startTime", "end-time": "endTime"} {
+			if s := viper.GetString(flag); s != "" {
+				t, err := api.ParseTimeIn(s, time.Local)
+				if err != nil {
+					errs = multierror.Append(errs, fmt.Errorf("%s could not be parsed: %w", flag, err))
+					continue
+				}
+				input[field] = t.Format(time.RFC3339)
+			}
+		}
+
+		actions := viper.GetStringSlice("action")
+		if len(actions) == 0 {
+			errs = multierror.Append(errs, errors.New("must specify at least one action"))
+		}
+		storage := viper.GetString("storage")
+		if storage == "" {
+			errs = multierror.Append(errs, errors.New("must specify where to store data"))
+		}
+		if errs != nil {
+			return errs
+		}
+
+		now := time.Now()
+		id := viper.GetString("message-id")
+		if id == "" {
+			id = fmt.Sprintf("local-%d", now.Unix())
+		}
+
+		var event interface{}
+		switch eventType := viper.GetString("event"); eventType {
+		case eventSQS:
+			var bodies [][]byte
+			for _, name := range actions {
+				input["action"] = name
+				body, err := json.Marshal(input)
+				if err != nil {
+					return err
+				}
+				bodies = append(bodies, body)
+			}
+			event = collector.NewSQSEvent(id, bodies...)
+		case eventSchedule:
+			input["actions"] = actions
+			detail, err := json.Marshal(input)
+			if err != nil {
+				return err
+			}
+			event = collector.NewScheduledEvent(id, detail, now)
+		default:
+			return fmt.Errorf("unknown event %q, expected %s or %s", eventType, eventSQS, eventSchedule)
+		}
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		env := map[string]string{
+			"SOLAREDGE_STORAGE":        storage,
+			"SOLAREDGE_CHECKPOINTS":    viper.GetString("checkpoints"),
+			"SOLAREDGE_API_KEY_SECRET": localAPIKeySecret,
+			// a bucket in the environment would win over local checkpoints.
+			"SOLAREDGE_BUCKET_NAME": "",
+		}
+		if layout := viper.GetString("key-layout"); layout != "" {
+			env["SOLAREDGE_KEY_LAYOUT"] = layout
+		}
+
+		handler := collector.NewHandler()
+		handler.Getenv = func(key string) string {
+			if v, ok := env[key]; ok {
+				return v
+			}
+			return os.Getenv(key)
+		}
+		handler.GetAPIKey = func(string) (string, error) {
+			return apiKey, nil
+		}
+		handler.ClientOptions = clientOptions
+
+		result, err := handler.HandleRequest(cmd.Context(), payload)
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(result); encodeErr != nil {
+			return encodeErr
+		}
+		if err != nil {
+			return err
+		}
+		if response, ok := result.(events.SQSEventResponse); ok && len(response.BatchItemFailures) > 0 {
+			return fmt.Errorf("%d of %d messages failed", len(response.BatchItemFailures), len(actions))
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(lambdaLocalCmd)
+
+	lambdaLocalCmd.Flags().StringP("event", "", eventSQS, "Which event to send: sqs, a message per action, or schedule, one EventBridge event for them all")
+	lambdaLocalCmd.Flags().StringSliceP("action", "", []string{}, "Actions to run, energy or telemetry; use multiple flags for both")
+	lambdaLocalCmd.Flags().StringSliceP("site-id", "", []string{}, "Specify site IDs; use multiple flags for multiple sites - will default to every site the key can see")
+	lambdaLocalCmd.Flags().StringP("time-unit", "", "", "Time unit, DAY, HOUR or QUARTER_OF_AN_HOUR - will default to the collector's for the action")
+	lambdaLocalCmd.Flags().StringP("window", "", "", "How far back to start without a checkpoint, like 48h, or installation for the site's installation date - will default to the collector's")
+	lambdaLocalCmd.Flags().StringP("start-time", "", "", "Backfill from this local time, whatever the checkpoints say")
+	lambdaLocalCmd.Flags().StringP("end-time", "", "", "Stop at this local time - will default to now")
+	lambdaLocalCmd.Flags().StringP("message-id", "", "", "Message or event ID, which names the run's manifests - will default to one from the time")
+	lambdaLocalCmd.Flags().StringP("storage", "", "", "Where the collector writes data - a directory or s3://bucket/prefix")
+	lambdaLocalCmd.Flags().StringP("key-layout", "", "", "Object key layout - will default to the collector's Hive-style layout")
+	addCheckpointFlags(lambdaLocalCmd, "Where the collector keeps checkpoints - will default to checkpoints.json in a storage directory, or the storage prefix in S3")
+}
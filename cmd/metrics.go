@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/dreamlibrarian/solaredge-monitoring/metrics"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var metricsCmd = &cobra.Command{
+	Use:         "serve-metrics",
+	Short:       "Serve current site readings as Prometheus metrics",
+	Annotations: map[string]string{annotationDaemon: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := &action.MetricsConfig{
+			DiscoverSites: viper.GetBool("all-sites"),
+			SiteIDs:       viper.GetStringSlice("site-id"),
+		}
+		if config.DiscoverSites && len(config.SiteIDs) > 0 {
+			return errors.New("cannot set all-sites and specify site-ids")
+		} else if !config.DiscoverSites && len(config.SiteIDs) == 0 {
+			return errors.New("must set all-sites or specify at least one site-id")
+		}
+
+		budget := viper.GetInt("daily-request-budget")
+		minimum := viper.GetDuration("min-interval")
+		listenAddress := viper.GetString("listen-address")
+
+		act := action.NewMetricsAction(apiKey, clientOptions...)
+		exporter := metrics.NewExporter()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		go exporter.Run(ctx, func() (map[string]*action.SiteSnapshot, error) {
+			return act.Do(config)
+		}, budget, minimum)
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", exporter.Handler())
+		server := &http.Server{Addr: listenAddress, Handler: mux}
+
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+
+		log.Info().Str("address", listenAddress).Msg("serving metrics")
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("unable to serve metrics on %s: %w", listenAddress, err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(metricsCmd)
+
+	metricsCmd.Flags().StringSliceP("site-id", "", []string{}, "Specify site IDs; use multiple flags for multiple sites")
+	metricsCmd.Flags().BoolP("all-sites", "", false, "Discover available sites and use them all")
+
+	metricsCmd.Flags().StringP("listen-address", "", ":9661", "Address to serve /metrics on")
+	metricsCmd.Flags().IntP("daily-request-budget", "", metrics.DefaultDailyRequestBudget, "API requests per site per day to spread refreshes across")
+	metricsCmd.Flags().DurationP("min-interval", "", 5*time.Minute, "Never refresh more often than this, whatever the budget allows")
+}
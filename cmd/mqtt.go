@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/dreamlibrarian/solaredge-monitoring/metrics"
+	"github.com/dreamlibrarian/solaredge-monitoring/mqtt"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const mqttConnectTimeout = 30 * time.Second
+
+var mqttCmd = &cobra.Command{
+	Use:         "publish-mqtt",
+	Short:       "Publish current site readings to MQTT, with Home Assistant discovery",
+	Annotations: map[string]string{annotationDaemon: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := &action.MetricsConfig{
+			DiscoverSites: viper.GetBool("all-sites"),
+			SiteIDs:       viper.GetStringSlice("site-id"),
+			PowerFlow:     !viper.GetBool("skip-power-flow"),
+		}
+		if config.DiscoverSites && len(config.SiteIDs) > 0 {
+			return errors.New("cannot set all-sites and specify site-ids")
+		} else if !config.DiscoverSites && len(config.SiteIDs) == 0 {
+			return errors.New("must set all-sites or specify at least one site-id")
+		}
+
+		options := mqtt.Options{
+			TopicPrefix:     viper.GetString("topic-prefix"),
+			DiscoveryPrefix: viper.GetString("discovery-prefix"),
+		}
+		if viper.GetBool("no-discovery") {
+			options.DiscoveryPrefix = ""
+		}
+
+		var publisher *mqtt.Publisher
+		clientOpts := paho.NewClientOptions().
+			AddBroker(viper.GetString("broker")).
+			SetClientID(viper.GetString("client-id")).
+			SetUsername(viper.GetString("mqtt-username")).
+			SetPassword(viper.GetString("mqtt-password")).
+			SetWill(options.AvailabilityTopic(), mqtt.PayloadOffline, 1, true).
+			SetAutoReconnect(true).
+			SetOnConnectHandler(func(paho.Client) {
+				// this runs again on every reconnect, which puts us back online after the will fires.
+				if err := publisher.Announce(); err != nil {
+					log.Error().Err(err).Msg("unable to mark publisher online")
+				}
+			})
+		client := paho.NewClient(clientOpts)
+		publisher = mqtt.NewPublisher(client, options)
+
+		token := client.Connect()
+		if !token.WaitTimeout(mqttConnectTimeout) {
+			return fmt.Errorf("timed out connecting to %s", viper.GetString("broker"))
+		}
+		if err := token.Error(); err != nil {
+			return fmt.Errorf("unable to connect to %s: %w", viper.GetString("broker"), err)
+		}
+		defer client.Disconnect(250)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		act := action.NewMetricsAction(apiKey, clientOptions...)
+		publisher.Run(ctx, func() (map[string]*action.SiteSnapshot, error) {
+			return act.Do(config)
+		}, viper.GetInt("daily-request-budget"), viper.GetDuration("min-interval"))
+
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(mqttCmd)
+
+	mqttCmd.Flags().StringSliceP("site-id", "", []string{}, "Specify site IDs; use multiple flags for multiple sites")
+	mqttCmd.Flags().BoolP("all-sites", "", false, "Discover available sites and use them all")
+	mqttCmd.Flags().BoolP("skip-power-flow", "", false, "Don't fetch current power flow; saves a request per refresh, but there's no battery state")
+
+	mqttCmd.Flags().StringP("broker", "", "tcp://localhost:1883", "MQTT broker to publish to")
+	mqttCmd.Flags().StringP("client-id", "", "solaredge-monitoring", "MQTT client ID")
+	mqttCmd.Flags().StringP("mqtt-username", "", "", "MQTT username")
+	mqttCmd.Flags().StringP("mqtt-password", "", "", "MQTT password")
+	mqttCmd.Flags().StringP("topic-prefix", "", mqtt.DefaultTopicPrefix, "Topic prefix for sensor state")
+	mqttCmd.Flags().StringP("discovery-prefix", "", mqtt.DefaultDiscoveryPrefix, "Home Assistant discovery prefix")
+	mqttCmd.Flags().BoolP("no-discovery", "", false, "Don't publish Home Assistant discovery config")
+
+	mqttCmd.Flags().IntP("daily-request-budget", "", metrics.DefaultDailyRequestBudget, "API requests per site per day to spread refreshes across")
+	mqttCmd.Flags().DurationP("min-interval", "", 5*time.Minute, "Never refresh more often than this, whatever the budget allows")
+}
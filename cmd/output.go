@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
+	"github.com/dreamlibrarian/solaredge-monitoring/sink"
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// openSink works out where a command's output goes. --output-dir predates --output and still
+// means a directory of JSON files.
+func openSink() (sink.Sink, error) {
+	output := viper.GetString("output")
+	outputDir := viper.GetString("output-dir")
+
+	if output != "" && outputDir != "" {
+		return nil, fmt.Errorf("may only set one of output, output-dir")
+	}
+	if outputDir != "" {
+		return sink.NewDirectorySink(outputDir)
+	}
+	if output == "" {
+		output = "stdout:"
+	}
+
+	return sink.Open(output)
+}
+
+// streamOutput opens the command's sink and hands stream a write function, so each site's or
+// device's series go out as soon as they're fetched, batched per site and device. Sinks may hold
+// output back until they're closed, so closed, if set, is only called once that's succeeded;
+// it's where checkpoints move on.
+func streamOutput(family string, start, end time.Time, stream func(write func(data []series.Series) error) error, closed func() error) error {
+	output, err := openSink()
+	if err != nil {
+		return err
+	}
+
+	err = stream(func(data []series.Series) error {
+		return sink.WriteAll(output, family, start, end, data)
+	})
+	closeErr := output.Close()
+	if closeErr == nil && closed != nil {
+		closeErr = closed()
+	}
+	if closeErr != nil {
+		err = multierror.Append(err, closeErr)
+	}
+	return err
+}
+
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", "", fmt.Sprintf("Specify where output goes as a URI, like file:///data or stdout: - one of %s. Will default to stdout.", strings.Join(sink.Schemes(), ", ")))
+	cmd.Flags().StringP("output-dir", "", "", "Specify where output files belong")
+	cmd.Flags().MarkDeprecated("output-dir", "use --output file://<dir> instead")
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/pvoutput"
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var pvoutputCmd = &cobra.Command{
+	Use:   "upload-pvoutput",
+	Short: "Upload a site's energy, power and temperature to PVOutput.org",
+	Long: `Upload-pvoutput sends quarter-hour statuses through addbatchstatus, and a daily output through
+addoutput for each finished day. What's been uploaded is kept in the state file, so each run only
+sends what's new; if PVOutput's hourly limit is hit, the next run carries on.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var errs error
+		siteID := viper.GetString("site-id")
+		systemID := viper.GetString("system-id")
+		pvoutputKey := viper.GetString("pvoutput-api-key")
+		if siteID == "" {
+			errs = multierror.Append(errs, errors.New("must specify a site-id"))
+		}
+		if systemID == "" {
+			errs = multierror.Append(errs, errors.New("must specify a system-id"))
+		}
+		if pvoutputKey == "" {
+			errs = multierror.Append(errs, errors.New("must specify a pvoutput-api-key"))
+		}
+		var startTime time.Time
+		if s := viper.GetString("start-time"); s != "" {
+			var err error
+			if startTime, err = api.ParseTimeIn(s, time.Local); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("start time could not be parsed: %w", err))
+			}
+		}
+		if errs != nil {
+			return errs
+		}
+
+		state, err := pvoutput.LoadState(viper.GetString("state-file"))
+		if err != nil {
+			return err
+		}
+		progress := state.Progress(systemID)
+		if progress.SiteID != "" && progress.SiteID != siteID {
+			return fmt.Errorf("pvoutput system %s has been uploaded to from site %s, not %s", systemID, progress.SiteID, siteID)
+		}
+		progress.SiteID = siteID
+
+		// PVOutput refuses statuses older than its limit, so there's no point fetching them; an hour's
+		// grace keeps the oldest ones clear of the edge while they're uploaded.
+		now := time.Now()
+		oldest := now.Add(-viper.GetDuration("max-age") + time.Hour)
+		start := progress.LastStatus
+		if start.IsZero() && !startTime.IsZero() {
+			start = startTime
+		}
+		if start.Before(oldest) {
+			start = oldest
+		}
+
+		data, err := action.NewPVOutputAction(apiKey, clientOptions...).Do(&action.PVOutputConfig{
+			SiteID:        siteID,
+			StartTime:     start,
+			EndTime:       now,
+			SkipTelemetry: viper.GetBool("skip-telemetry"),
+		})
+		if err != nil {
+			return err
+		}
+
+		uploader := &pvoutput.Uploader{
+			Client:    pvoutput.NewClient(pvoutputKey, systemID, viper.GetString("pvoutput-url")),
+			State:     state,
+			SystemID:  systemID,
+			BatchSize: viper.GetInt("batch-size"),
+		}
+
+		// a status for the quarter hour we're in would be partial, and PVOutput won't take the future.
+		var statuses []pvoutput.Status
+		for _, status := range pvoutput.Statuses(data.Energy, data.Power, data.Telemetry) {
+			if !status.Time.Before(oldest) && !status.Time.After(now) {
+				statuses = append(statuses, status)
+			}
+		}
+		uploaded, err := uploader.UploadStatuses(statuses)
+		log.Info().Int("statuses", uploaded).Msg("uploaded statuses to pvoutput")
+		if errors.Is(err, pvoutput.ErrRateLimited) {
+			log.Warn().Msg("pvoutput rate limit reached; run again later to upload the rest")
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if viper.GetBool("skip-outputs") {
+			return nil
+		}
+		year, month, day := now.In(data.Location).Date()
+		today := time.Date(year, month, day, 0, 0, 0, 0, data.Location)
+		var outputs []pvoutput.Output
+		for _, output := range pvoutput.Outputs(data.Energy, data.Power) {
+			if !output.Date.Before(oldest) {
+				outputs = append(outputs, output)
+			}
+		}
+		uploaded, err = uploader.UploadOutputs(outputs, today)
+		log.Info().Int("outputs", uploaded).Msg("uploaded daily outputs to pvoutput")
+		if errors.Is(err, pvoutput.ErrRateLimited) {
+			log.Warn().Msg("pvoutput rate limit reached; run again later to upload the rest")
+			return nil
+		}
+		return err
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(pvoutputCmd)
+
+	pvoutputCmd.Flags().StringP("site-id", "", "", "Specify the site to upload")
+	pvoutputCmd.Flags().StringP("system-id", "", "", "Specify the PVOutput system ID to upload to")
+	pvoutputCmd.Flags().StringP("pvoutput-api-key", "", "", "Specify the PVOutput API key")
+	pvoutputCmd.Flags().StringP("pvoutput-url", "", pvoutput.DefaultBaseURL, "PVOutput base URL")
+	pvoutputCmd.Flags().StringP("state-file", "", "pvoutput-state.json", "Where to remember what's been uploaded")
+	pvoutputCmd.Flags().StringP("start-time", "", "", "Where the first upload to a system starts, in local time - will default to as far back as PVOutput allows.")
+
+	pvoutputCmd.Flags().IntP("batch-size", "", pvoutput.MaxBatchSize, "Statuses per addbatchstatus call; donors may use up to 100")
+	pvoutputCmd.Flags().DurationP("max-age", "", pvoutput.MaxStatusAge, "Oldest status PVOutput will accept; donors may use up to 2160h")
+	pvoutputCmd.Flags().BoolP("skip-telemetry", "", false, "Don't fetch inverter telemetry; saves requests, but there's no temperature or voltage")
+	pvoutputCmd.Flags().BoolP("skip-outputs", "", false, "Only upload statuses, not daily outputs")
+}
@@ -5,12 +5,23 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/dreamlibrarian/solaredge-monitoring/client"
+	"github.com/dreamlibrarian/solaredge-monitoring/secret"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var apiKey string
 
+// annotationNoAPIKey marks commands that never call the monitoring API.
+const annotationNoAPIKey = "no-api-key"
+
+// annotationDaemon marks commands that keep running and polling; they only cache responses when
+// given a cache-dir.
+const annotationDaemon = "daemon"
+
+var clientOptions []client.Option
+
 var RootCmd = &cobra.Command{
 	Use:   "solaredge-monitoring",
 	Short: "A toolkit for rendering data from Solaredge monitoring.",
@@ -40,8 +51,45 @@ var RootCmd = &cobra.Command{
 			viper.Debug()
 		}
 
+		recordPath := viper.GetString("record")
+		replayPath := viper.GetString("replay")
+		if recordPath != "" && replayPath != "" {
+			return errors.New("may only set one of record, replay")
+		}
+		if recordPath != "" {
+			clientOptions = append(clientOptions, client.WithTransport(client.NewRecordingRoundTripper(recordPath, nil)))
+		}
+		if replayPath != "" {
+			replayer, err := client.NewReplayingRoundTripper(replayPath)
+			if err != nil {
+				return err
+			}
+			clientOptions = append(clientOptions, client.WithTransport(replayer))
+		}
+		// Cassettes want to see every real interaction, so the cache stays out of their way.
+		cacheDir := viper.GetString("cache-dir")
+		_, daemon := cmd.Annotations[annotationDaemon]
+		if recordPath == "" && replayPath == "" && !viper.GetBool("no-cache") && (cacheDir != "" || !daemon) {
+			if cacheDir == "" {
+				cacheDir, err = client.DefaultCacheDir()
+				if err != nil {
+					return err
+				}
+			}
+			clientOptions = append(clientOptions, client.WithTransport(client.NewCachingRoundTripper(cacheDir, nil)))
+		}
+
 		apiKey = viper.GetString("api-key")
-		if apiKey == "" {
+		if _, ok := cmd.Annotations[annotationNoAPIKey]; ok {
+			return nil
+		}
+		if secret.IsReference(apiKey) {
+			apiKey, err = secret.NewResolver().Resolve(apiKey)
+			if err != nil {
+				return fmt.Errorf("unable to resolve api-key: %w", err)
+			}
+		}
+		if apiKey == "" && replayPath == "" {
 			return errors.New("api-key must be specified")
 		}
 
@@ -51,7 +99,11 @@ var RootCmd = &cobra.Command{
 
 func init() {
 
-	RootCmd.PersistentFlags().StringP("api-key", "", "", "API Key")
+	RootCmd.PersistentFlags().StringP("api-key", "", "", "API Key, or where to find it - env:NAME, file:PATH, secretsmanager:ID[#field], ssm:NAME or an ARN")
 	RootCmd.PersistentFlags().BoolP("verbose", "v", false, "Verbose Mode")
 	RootCmd.PersistentFlags().StringP("config", "c", "solaredge.yml", "Config File")
+	RootCmd.PersistentFlags().StringP("record", "", "", "Record API interactions to this cassette file, with the API key redacted")
+	RootCmd.PersistentFlags().StringP("replay", "", "", "Replay API interactions from this cassette file instead of calling the API")
+	RootCmd.PersistentFlags().StringP("cache-dir", "", "", "Directory for cached API responses - will default to the user cache directory, except for serve-metrics and publish-mqtt, which only cache when this is set.")
+	RootCmd.PersistentFlags().BoolP("no-cache", "", false, "Always call the API rather than using cached responses")
 }
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/archive"
+	"github.com/dreamlibrarian/solaredge-monitoring/sink"
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Bring a local SQLite archive of sites, energy and telemetry up to date",
+	Long: `Sync keeps a SQLite database of site details, inventory snapshots, energy and telemetry. Each run
+only fetches what the database doesn't have yet, per site, inverter and time unit; today is fetched
+again every time, since the API keeps filling it in.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := getSyncConfig()
+		if err != nil {
+			return err
+		}
+
+		database := viper.GetString("database")
+		store, err := openSyncStore(database)
+		if err != nil {
+			return err
+		}
+
+		err = action.NewSyncAction(apiKey, clientOptions...).Do(config, store)
+		if closeErr := store.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("unable to close archive %s: %w", database, closeErr)
+		}
+		return err
+	},
+}
+
+type syncStore interface {
+	action.SyncStore
+	Close() error
+}
+
+// openSyncStore takes a postgres:// URL to sync into Postgres, and anything else as a SQLite file.
+func openSyncStore(database string) (syncStore, error) {
+	if strings.HasPrefix(database, "postgres://") || strings.HasPrefix(database, "postgresql://") {
+		return sink.OpenPostgres(database)
+	}
+	return archive.Open(database)
+}
+
+func getSyncConfig() (*action.SyncConfig, error) {
+	config := action.SyncConfig{}
+	var err, errs error
+
+	if startTime := viper.GetString("start-time"); startTime != "" {
+		if config.StartTime, err = api.ParseTimeIn(startTime, time.Local); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("start time could not be parsed: %w", err))
+		}
+	}
+
+	byHour := viper.GetBool("by-hour")
+	byDay := viper.GetBool("by-day")
+	byQuarterHour := viper.GetBool("by-quarter-hour")
+	var timeSetCount int
+	if byHour {
+		config.TimeUnit = api.TimeUnitHour
+		timeSetCount++
+	}
+	if byDay {
+		config.TimeUnit = api.TimeUnitDay
+		timeSetCount++
+	}
+	if byQuarterHour {
+		config.TimeUnit = api.TimeUnitQuarterHour
+		timeSetCount++
+	}
+	if timeSetCount == 0 {
+		config.TimeUnit = api.TimeUnitHour
+	} else if timeSetCount > 1 {
+		errs = multierror.Append(errs, errors.New("may only set one of by-day, by-hour, by-quarter-hour"))
+	}
+
+	config.DiscoverSites = viper.GetBool("all-sites")
+	config.SiteIDs = viper.GetStringSlice("site-id")
+	if config.DiscoverSites && len(config.SiteIDs) > 0 {
+		errs = multierror.Append(errs, errors.New("cannot set all-sites and specify site-ids"))
+	} else if !config.DiscoverSites && len(config.SiteIDs) == 0 {
+		errs = multierror.Append(errs, errors.New("must set all-sites or specify at least one site-id"))
+	}
+
+	config.SkipTelemetry = viper.GetBool("skip-telemetry")
+
+	return &config, errs
+}
+
+func init() {
+	RootCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().StringP("database", "", "solaredge.db", "SQLite database to keep the archive in, created if it doesn't exist, or a postgres:// URL")
+	syncCmd.Flags().StringP("start-time", "", "", "How far back to go for anything not synced yet, in local time - will default to each site's installation date.")
+	syncCmd.Flags().BoolP("by-hour", "", false, "Archive hourly energy samples")
+	syncCmd.Flags().BoolP("by-quarter-hour", "", false, "Archive 15-minute energy samples")
+	syncCmd.Flags().BoolP("by-day", "", false, "Archive daily energy samples")
+	syncCmd.Flags().BoolP("skip-telemetry", "", false, "Only archive site details, inventory and energy")
+
+	syncCmd.Flags().StringSliceP("site-id", "", []string{}, "Specify site IDs; use multiple flags for multiple sites")
+	syncCmd.Flags().BoolP("all-sites", "", false, "Discover available sites and use them all")
+}
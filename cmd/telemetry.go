@@ -1,15 +1,14 @@
 package cmd
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"time"
 
 	"github.com/dreamlibrarian/solaredge-monitoring/action"
 	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/checkpoint"
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
 	"github.com/hashicorp/go-multierror"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -25,25 +24,27 @@ var telemetryCmd = &cobra.Command{
 			return err
 		}
 
-		action := action.NewTelemetryAction(apiKey)
+		action := action.NewTelemetryAction(apiKey, clientOptions...)
 
-		fsMap, err := action.Do(config)
+		incremental, store, err := getIncrementalConfig(config.TimeUnit, config.StartTime, config.EndTime, config.DiscoverSites, config.SiteIDs, config.SerialNumbers)
 		if err != nil {
 			return err
 		}
-
-		for path, contents := range fsMap {
-			data, err := json.Marshal(contents)
-			if err != nil {
-				return err
-			}
-			err = ioutil.WriteFile(path, data, 0644)
-			if err != nil {
-				return err
-			}
+		if incremental != nil {
+			// checkpoints only move once the output's closed, so nothing's skipped if that fails.
+			buffer := checkpoint.NewBuffer(store)
+			return streamOutput(series.FamilyTelemetry, config.StartTime, config.EndTime, func(write func([]series.Series) error) error {
+				return action.Incremental(incremental, buffer, func(siteID, serial string, telemetries []api.Telemetry) error {
+					return write(series.FromTelemetry(siteID, serial, telemetries))
+				})
+			}, buffer.Commit)
 		}
 
-		return nil
+		return streamOutput(series.FamilyTelemetry, config.StartTime, config.EndTime, func(write func([]series.Series) error) error {
+			return action.Stream(config, func(siteID, serial string, telemetries []api.Telemetry) error {
+				return write(series.FromTelemetry(siteID, serial, telemetries))
+			})
+		}, nil)
 	},
 }
 
@@ -56,8 +57,8 @@ func parseDate(timestamp string) (time.Time, error) {
 func init() {
 	RootCmd.AddCommand(telemetryCmd)
 
-	telemetryCmd.Flags().StringP("start-time", "", "", "Specify the start time for telemetry - will default to 24 hours ago.")
-	telemetryCmd.Flags().StringP("end-time", "", "", "Specify the start time for telemetry - will default to now.")
+	telemetryCmd.Flags().StringP("start-time", "", "", "Specify the start time for telemetry in local time - will default to 24 hours ago.")
+	telemetryCmd.Flags().StringP("end-time", "", "", "Specify the end time for telemetry in local time - will default to now.")
 	telemetryCmd.Flags().BoolP("by-hour", "", false, "Specify hourly samples")
 	telemetryCmd.Flags().BoolP("by-quarter-hour", "", false, "Specify 15-minute samples")
 	telemetryCmd.Flags().BoolP("by-day", "", false, "Specify daily samples")
@@ -67,7 +68,8 @@ func init() {
 	telemetryCmd.Flags().StringSliceP("serial-number", "", []string{}, "Specify telemetry source serial numbers")
 	telemetryCmd.Flags().BoolP("all-equipment", "", false, "Discover available equipment at each specified site")
 
-	telemetryCmd.Flags().StringP("output-dir", "", "", "Specify where output files belong")
+	addOutputFlags(telemetryCmd)
+	addCheckpointFlags(telemetryCmd, "Only fetch what's new since the last run, per inverter, with start-time for inverters seen for the first time")
 }
 
 func getTelemetryConfig() (*action.TelemetryActionConfig, error) {
@@ -78,7 +80,7 @@ func getTelemetryConfig() (*action.TelemetryActionConfig, error) {
 	if startTime == "" {
 		config.StartTime = time.Now().Add(-24 * time.Hour)
 	} else {
-		if config.StartTime, err = api.ParseTime(startTime); err != nil {
+		if config.StartTime, err = api.ParseTimeIn(startTime, time.Local); err != nil {
 			errs = multierror.Append(errs, fmt.Errorf("start time could not be parsed: %w", err))
 		}
 	}
@@ -87,8 +89,8 @@ func getTelemetryConfig() (*action.TelemetryActionConfig, error) {
 	if endTime == "" {
 		config.EndTime = time.Now()
 	} else {
-		if config.EndTime, err = api.ParseTime(endTime); err != nil {
-			errs = multierror.Append(errs, fmt.Errorf("start time could not be parsed: %w", err))
+		if config.EndTime, err = api.ParseTimeIn(endTime, time.Local); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("end time could not be parsed: %w", err))
 		}
 	}
 
@@ -120,16 +122,5 @@ func getTelemetryConfig() (*action.TelemetryActionConfig, error) {
 	config.DiscoverSerials = viper.GetBool("all-equipment")
 	config.SerialNumbers = viper.GetStringSlice("serial-number")
 
-	outputDir := viper.GetString("output-dir")
-	outputDirStat, err := os.Stat(outputDir)
-	if os.IsNotExist(err) {
-		err = os.Mkdir(outputDir, 0755)
-		if err != nil {
-			errs = multierror.Append(errs, fmt.Errorf("unable to create output directory %s: %w", outputDir, err))
-		}
-	} else if !outputDirStat.IsDir() {
-		errs = multierror.Append(errs, fmt.Errorf("path %s must refer to a directory", outputDir))
-	}
-
 	return &config, errs
 }
@@ -0,0 +1,242 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/checkpoint"
+	"github.com/dreamlibrarian/solaredge-monitoring/client"
+	"github.com/dreamlibrarian/solaredge-monitoring/secret"
+	"github.com/dreamlibrarian/solaredge-monitoring/storage"
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog/log"
+)
+
+/*
+
+Package collector is the Lambda function; lambda/ just starts it, and the
+lambda-local command runs it in-process against local storage.
+
+arright, invocation model abstractions suck.
+
+AWS credentials will come from the lambda policy.
+
+API key comes from Secrets Manager; the environment names the secret
+(SOLAREDGE_API_KEY_SECRET), or gives any reference the secret package
+can resolve, like ssm:/solaredge/api-key. It also names the bucket to
+write to, or a directory (SOLAREDGE_STORAGE) to run the same thing
+locally.
+
+Everything else can be set in the environment as a default, then in the
+message body as JSON, then in message attributes; see config.go. An
+EventBridge schedule can invoke it directly, its input read like a
+message body, with "actions" to run more than one; see events.go.
+
+Checkpoints are kept per site for energy and per inverter for telemetry,
+so a failing site doesn't hold the others back. A new site's energy
+starts at its installation date, and its telemetry a day back, unless
+given a window; "installation" starts both there. They live under
+<prefix>/checkpoints/ in the bucket unless SOLAREDGE_CHECKPOINTS says
+otherwise; a DynamoDB table stops overlapping invocations clobbering each
+other. The checkpoints command can show and reset them.
+
+The single <prefix>/solaredge-monitoring-checkpoint object older versions
+kept for every site is still read: energy for a site without a checkpoint
+of its own starts from there, unless the site was installed since, so an
+upgrade picks up where it left off. It can be deleted once every site has
+its own.
+
+Objects are laid out Hive-style for Athena and Glue, by default
+dataset=<action>/site=<id>/[serial=<sn>/]year=/month=/day=/, an object
+per site-local day, named for the day; SOLAREDGE_KEY_LAYOUT changes it.
+They're newline-delimited JSON, a row per period, and each run merges
+what it fetched into the day's object, so a period fetched again is
+replaced rather than repeated. Each run writes a manifest of the objects
+it wrote, with row counts and checksums, under
+manifests/dataset=<action>/.
+
+*/
+
+// Handler runs the collector for each event. The zero value isn't usable; NewHandler fills in
+// what the Lambda runtime has, and anything running it elsewhere can swap parts out.
+type Handler struct {
+	// Getenv reads the function's configuration, like os.Getenv.
+	Getenv func(string) string
+	// Now is when a run ends, unless a message says otherwise.
+	Now func() time.Time
+	// GetAPIKey looks up the API key from SOLAREDGE_API_KEY_SECRET.
+	GetAPIKey     func(secretID string) (string, error)
+	ClientOptions []client.Option
+}
+
+func NewHandler() *Handler {
+	return &Handler{
+		Getenv:    os.Getenv,
+		Now:       time.Now,
+		GetAPIKey: apiKeyFrom(secret.NewResolver()),
+	}
+}
+
+// HandleRequest takes SQS batches, and EventBridge schedules for running without a queue.
+func (h *Handler) HandleRequest(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	sqsEvent, scheduled, err := decodeEvent(payload, h.invocationID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if sqsEvent != nil {
+		return handleSQSEvent(ctx, *sqsEvent, h.actionForRecord), nil
+	}
+	return h.handleScheduledEvent(ctx, scheduled)
+}
+
+// invocationID names runs whose event has no ID of its own: the Lambda request ID, or the time
+// when there isn't one.
+func (h *Handler) invocationID(ctx context.Context) string {
+	if lc, ok := lambdacontext.FromContext(ctx); ok && lc.AwsRequestID != "" {
+		return lc.AwsRequestID
+	}
+	return h.Now().UTC().Format(runIDTimeFormat)
+}
+
+// handleSQSEvent reports just the messages that failed, so only they're redelivered; the event
+// source mapping needs ReportBatchItemFailures turned on for SQS to take notice. A message
+// delivered twice in one batch is only run once.
+func handleSQSEvent(ctx context.Context, event events.SQSEvent, run func(context.Context, events.SQSMessage) (string, error)) events.SQSEventResponse {
+	response := events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}
+	seen := make(map[string]bool, len(event.Records))
+	for _, record := range event.Records {
+		log := log.With().Str("messageid", record.MessageId).Logger()
+		if seen[record.MessageId] {
+			log.Info().Msg("skipping message delivered twice in one batch")
+			continue
+		}
+		seen[record.MessageId] = true
+
+		result, err := run(ctx, record)
+		if err != nil {
+			log.Error().Err(err).Msg("message failed, leaving it for redelivery")
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+			continue
+		}
+		log.Info().Str("result", result).Msg("message done")
+	}
+	return response
+}
+
+// handleScheduledEvent runs every action a schedule asks for, even after one fails, since a
+// schedule's retry runs them all again anyway.
+func (h *Handler) handleScheduledEvent(ctx context.Context, messages []events.SQSMessage) (string, error) {
+	sb := strings.Builder{}
+	var errs error
+	for _, message := range messages {
+		resultString, err := h.actionForRecord(ctx, message)
+		if err != nil {
+			log.Error().Err(err).Str("id", message.MessageId).Msg("scheduled action failed")
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		sb.WriteString(resultString)
+		sb.WriteString("\n")
+	}
+	return sb.String(), errs
+}
+
+func (h *Handler) actionForRecord(ctx context.Context, message events.SQSMessage) (string, error) {
+	config, err := loadConfig(h.Getenv, message, h.Now())
+	if err != nil {
+		return "", fmt.Errorf("message %s has an invalid configuration: %w", message.MessageId, err)
+	}
+
+	checkpoints, err := checkpoint.Open(config.Checkpoints)
+	if err != nil {
+		return "", err
+	}
+	objects, err := storage.Open(config.Storage)
+	if err != nil {
+		return "", err
+	}
+
+	switch config.Action {
+	case actionEnergy:
+		return "executed energy action", h.energyAction(ctx, config, checkpoints, objects)
+	case actionTelemetry:
+		return "executed telemetry action", h.telemetryAction(ctx, config, checkpoints, objects)
+	default:
+		// loadConfig has already checked this.
+		return "", fmt.Errorf("unknown action %q", config.Action)
+	}
+}
+
+// energyAction stores each site's new energy, an object per site-local day, from the site's own
+// checkpoint.
+func (h *Handler) energyAction(ctx context.Context, c *collectorConfig, checkpoints checkpoint.Store, objects storage.Store) error {
+	apiKey, err := h.GetAPIKey(c.APIKeySecret)
+	if err != nil {
+		return err
+	}
+
+	config := c.incrementalConfig()
+	config.Legacy, err = checkpoint.Legacy(checkpoints)
+	if err != nil {
+		return err
+	}
+	log.Debug().Interface("actionConfig", config).Msg("Invoking energy endpoint")
+
+	writer := storage.NewPartitionWriter(objects, c.Layout, actionEnergy, c.RunID, time.Now())
+	err = action.NewEnergyAction(apiKey, h.ClientOptions...).Incremental(config, checkpoints, func(siteID string, energy *api.Energy) error {
+		return writeEnergy(writer, siteID, energy)
+	})
+	return finishManifest(writer, err)
+}
+
+// telemetryAction stores each inverter's new telemetry, an object per site-local day, from the
+// inverter's own checkpoint.
+func (h *Handler) telemetryAction(ctx context.Context, c *collectorConfig, checkpoints checkpoint.Store, objects storage.Store) error {
+	apiKey, err := h.GetAPIKey(c.APIKeySecret)
+	if err != nil {
+		return err
+	}
+
+	config := c.incrementalConfig()
+	log.Debug().Interface("actionConfig", config).Msg("Invoking telemetry endpoint")
+
+	writer := storage.NewPartitionWriter(objects, c.Layout, actionTelemetry, c.RunID, time.Now())
+	err = action.NewTelemetryAction(apiKey, h.ClientOptions...).Incremental(config, checkpoints, func(siteID, serial string, telemetries []api.Telemetry) error {
+		return writeTelemetry(writer, siteID, serial, telemetries)
+	})
+	return finishManifest(writer, err)
+}
+
+// finishManifest writes the run's manifest even when some sites failed, since what the others
+// wrote is there all the same.
+func finishManifest(writer *storage.PartitionWriter, err error) error {
+	manifest, manifestErr := writer.Finish(time.Now())
+	if manifestErr != nil {
+		return multierror.Append(err, manifestErr)
+	}
+	log.Info().Str("run", manifest.RunID).Int("objects", len(manifest.Objects)).Msg("run finished")
+	return err
+}
+
+// apiKeyFrom resolves SOLAREDGE_API_KEY_SECRET as a secret reference, like env:NAME or
+// ssm:/solaredge/api-key; a bare name is a Secrets Manager secret, as it's always been.
+func apiKeyFrom(resolver *secret.Resolver) func(string) (string, error) {
+	return func(ref string) (string, error) {
+		if !secret.IsReference(ref) {
+			ref = secret.SchemeSecretsManager + ":" + ref
+		}
+		apiKey, err := resolver.Resolve(ref)
+		if err != nil {
+			return "", fmt.Errorf("unable to fetch API key: %w", err)
+		}
+		return apiKey, nil
+	}
+}
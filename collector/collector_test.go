@@ -0,0 +1,259 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/dreamlibrarian/solaredge-monitoring/checkpoint"
+	"github.com/dreamlibrarian/solaredge-monitoring/client"
+	"github.com/dreamlibrarian/solaredge-monitoring/secret"
+	"github.com/dreamlibrarian/solaredge-monitoring/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleSQSEventReportsFailures(t *testing.T) {
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "ok"},
+		{MessageId: "broken"},
+		{MessageId: "ok"},
+		{MessageId: "also-ok"},
+	}}
+
+	var runs []string
+	response := handleSQSEvent(context.Background(), event, func(ctx context.Context, message events.SQSMessage) (string, error) {
+		runs = append(runs, message.MessageId)
+		if message.MessageId == "broken" {
+			return "", errors.New("site is broken")
+		}
+		return "done", nil
+	})
+
+	assert.Equal(t, []string{"ok", "broken", "also-ok"}, runs, "a failure shouldn't stop the rest of the batch, and duplicates should only run once")
+	assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "broken"}}, response.BatchItemFailures)
+
+	response = handleSQSEvent(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{MessageId: "ok"}}}, func(context.Context, events.SQSMessage) (string, error) {
+		return "done", nil
+	})
+	assert.NotNil(t, response.BatchItemFailures, "an empty list tells SQS the whole batch succeeded")
+	assert.Empty(t, response.BatchItemFailures)
+}
+
+func TestHandleRequestLocally(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		start := r.URL.Query().Get("startTime")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/details"):
+			w.Write([]byte(`{"details":{"id":12345,"name":"Home","location":{"timeZone":"UTC"}}}`))
+		case strings.HasSuffix(r.URL.Path, "/inventory"):
+			w.Write([]byte(`{"Inventory":{"inverters":[{"name":"Inverter 1","SN":"7E1234AB-12"}]}}`))
+		case strings.HasSuffix(r.URL.Path, "/energy"):
+			fmt.Fprintf(w, `{"energy":{"timeUnit":"HOUR","unit":"Wh","values":[{"date":%q,"value":100}]}}`, start)
+		case strings.HasSuffix(r.URL.Path, "/data"):
+			fmt.Fprintf(w, `{"data":{"count":1,"telemetries":[{"date":%q,"totalActivePower":1500}]}}`, start)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	env := map[string]string{envStorage: dir, envAPIKeySecret: "local", envSiteIDs: "12345"}
+	handler := &Handler{
+		Getenv: testEnv(env),
+		Now:    func() time.Time { return testNow },
+		GetAPIKey: func(secretID string) (string, error) {
+			assert.Equal(t, "local", secretID)
+			return "secret-key", nil
+		},
+		ClientOptions: []client.Option{client.WithBaseURL(server.URL)},
+	}
+
+	payload, err := json.Marshal(NewSQSEvent("m", []byte(`{"action":"energy"}`), []byte(`{"action":"bogus"}`)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	result, err := handler.HandleRequest(context.Background(), payload)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{{ItemIdentifier: "m-2"}}}, result)
+
+	payload, err = json.Marshal(NewScheduledEvent("e", []byte(`{"actions":["telemetry"]}`), testNow))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = handler.HandleRequest(context.Background(), payload)
+	assert.NoError(t, err)
+
+	objects, err := storage.NewFileStore(dir).List("manifests")
+	if assert.NoError(t, err) && assert.Len(t, objects, 2, "each run should leave a manifest") {
+		assert.Contains(t, objects[0].Key, "dataset=energy/")
+		assert.Contains(t, objects[1].Key, "dataset=telemetry/")
+	}
+
+	checkpoints, err := checkpoint.Open(filepath.Join(dir, "checkpoints.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	list, err := checkpoints.List()
+	assert.NoError(t, err)
+	assert.Len(t, list, 2, "checkpoints should be kept with the data")
+}
+
+type fakeSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+}
+
+func (f *fakeSecretsManager) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	if aws.StringValue(input.SecretId) != "solaredge-api-key" {
+		return nil, errors.New("ResourceNotFoundException")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String("FROMSECRET\n")}, nil
+}
+
+func TestAPIKeyFrom(t *testing.T) {
+	resolver := secret.NewResolver()
+	resolver.SecretsManager = &fakeSecretsManager{}
+	resolver.Getenv = testEnv(map[string]string{"SOLAREDGE_API_KEY": "FROMENV"})
+	getAPIKey := apiKeyFrom(resolver)
+
+	apiKey, err := getAPIKey("solaredge-api-key")
+	if assert.NoError(t, err, "a bare name should be a Secrets Manager secret") {
+		assert.Equal(t, "FROMSECRET", apiKey)
+	}
+	apiKey, err = getAPIKey("env:SOLAREDGE_API_KEY")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "FROMENV", apiKey)
+	}
+	_, err = getAPIKey("missing")
+	assert.Error(t, err)
+}
+
+func TestHandleRequestTwiceKeepsOneRowPerPeriod(t *testing.T) {
+	const apiTime = "2006-01-02 15:04:05"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		start, _ := time.Parse(apiTime, r.URL.Query().Get("startTime"))
+		end, _ := time.Parse(apiTime, r.URL.Query().Get("endTime"))
+		var values []string
+		for hour := start.Truncate(time.Hour); hour.Before(end); hour = hour.Add(time.Hour) {
+			// the hour in progress is partial, and grows from one run to the next.
+			value := 100
+			if hour.Add(time.Hour).After(end) {
+				value = int(end.Sub(hour).Minutes())
+			}
+			values = append(values, fmt.Sprintf(`{"date":%q,"value":%d}`, hour.Format(apiTime), value))
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/details"):
+			w.Write([]byte(`{"details":{"id":12345,"name":"Home","location":{"timeZone":"UTC"}}}`))
+		case strings.HasSuffix(r.URL.Path, "/energy"):
+			fmt.Fprintf(w, `{"energy":{"timeUnit":"HOUR","unit":"Wh","values":[%s]}}`, strings.Join(values, ","))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	now := time.Date(2021, 11, 2, 14, 37, 0, 0, time.UTC)
+	handler := &Handler{
+		Getenv:        testEnv(map[string]string{envStorage: dir, envAPIKeySecret: "local", envSiteIDs: "12345", envWindow: "2h"}),
+		Now:           func() time.Time { return now },
+		GetAPIKey:     func(string) (string, error) { return "secret-key", nil },
+		ClientOptions: []client.Option{client.WithBaseURL(server.URL)},
+	}
+	run := func(id string) {
+		payload, err := json.Marshal(NewSQSEvent(id, []byte(`{"action":"energy"}`)))
+		if assert.NoError(t, err) {
+			result, err := handler.HandleRequest(context.Background(), payload)
+			assert.NoError(t, err)
+			assert.Empty(t, result.(events.SQSEventResponse).BatchItemFailures)
+		}
+	}
+
+	run("first")
+	now = now.Add(30 * time.Minute)
+	run("second")
+	run("second") // redelivered
+
+	store := storage.NewFileStore(dir)
+	objects, err := store.List("dataset=energy/")
+	if !assert.NoError(t, err) || !assert.Len(t, objects, 1, "every run should write the same day's object") {
+		return
+	}
+	data, _, err := store.Get(objects[0].Key)
+	if !assert.NoError(t, err) {
+		return
+	}
+	counts := make(map[string]int)
+	values := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var row energyRow
+		if assert.NoError(t, json.Unmarshal([]byte(line), &row)) {
+			counts[row.Date.UTC().Format(time.RFC3339)]++
+			values[row.Date.UTC().Format(time.RFC3339)] = int(row.Value)
+		}
+	}
+	assert.Equal(t, map[string]int{
+		"2021-11-02T12:00:00Z": 1,
+		"2021-11-02T13:00:00Z": 1,
+		"2021-11-02T14:00:00Z": 1,
+		"2021-11-02T15:00:00Z": 1,
+	}, counts, "each period should be stored once")
+	assert.Equal(t, 100, values["2021-11-02T14:00:00Z"], "the partial period should be replaced once it's complete")
+
+	manifests, err := store.List("manifests/")
+	if assert.NoError(t, err) {
+		assert.Len(t, manifests, 2, "a redelivered message's manifest should replace the first one's")
+	}
+}
+
+func TestHandleRequestConstantInputKeepsEachRunsManifest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/details"):
+			w.Write([]byte(`{"details":{"id":12345,"name":"Home","location":{"timeZone":"UTC"}}}`))
+		case strings.HasSuffix(r.URL.Path, "/energy"):
+			fmt.Fprintf(w, `{"energy":{"timeUnit":"HOUR","unit":"Wh","values":[{"date":%q,"value":100}]}}`, r.URL.Query().Get("startTime"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	now := time.Date(2021, 11, 2, 1, 0, 0, 0, time.UTC)
+	handler := &Handler{
+		Getenv:        testEnv(map[string]string{envStorage: dir, envAPIKeySecret: "local", envSiteIDs: "12345"}),
+		Now:           func() time.Time { return now },
+		GetAPIKey:     func(string) (string, error) { return "secret-key", nil },
+		ClientOptions: []client.Option{client.WithBaseURL(server.URL)},
+	}
+
+	// a rule with constant input sends just the input, with no event ID to name the run by.
+	for night := 0; night < 2; night++ {
+		_, err := handler.HandleRequest(context.Background(), []byte(`{"actions":["energy"]}`))
+		assert.NoError(t, err)
+		now = now.Add(24 * time.Hour)
+	}
+
+	manifests, err := storage.NewFileStore(dir).List("manifests/")
+	if assert.NoError(t, err) {
+		assert.Len(t, manifests, 2, "each night's run should keep a manifest of its own")
+	}
+}
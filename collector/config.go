@@ -0,0 +1,271 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/checkpoint"
+	"github.com/dreamlibrarian/solaredge-monitoring/storage"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	envAction       = "SOLAREDGE_ACTION"
+	envSiteIDs      = "SOLAREDGE_SITE_IDS"
+	envTimeUnit     = "SOLAREDGE_TIME_UNIT"
+	envWindow       = "SOLAREDGE_WINDOW"
+	envBucketName   = "SOLAREDGE_BUCKET_NAME"
+	envBucketPrefix = "SOLAREDGE_BUCKET_PREFIX"
+	envAPIKeySecret = "SOLAREDGE_API_KEY_SECRET"
+	envCheckpoints  = "SOLAREDGE_CHECKPOINTS"
+	envStorage      = "SOLAREDGE_STORAGE"
+	envKeyLayout    = "SOLAREDGE_KEY_LAYOUT"
+
+	attributeAction   = "action"
+	attributeSiteIDs  = "siteIds"
+	attributeTimeUnit = "timeUnit"
+	attributeWindow   = "window"
+
+	actionEnergy    = checkpoint.ActionEnergy
+	actionTelemetry = checkpoint.ActionTelemetry
+
+	// defaultWindow is how far back telemetry with no checkpoint starts. Energy starts at the
+	// site's installation date instead, unless given a window; telemetry takes a request per
+	// inverter per week of history, which would spend a new site's daily quota in one go.
+	defaultWindow = 24 * time.Hour
+
+	// windowInstallation, as a window, starts anything new at its site's installation date.
+	windowInstallation = "installation"
+
+	// runIDTimeFormat names runs that have nothing better to go by, after when they started.
+	runIDTimeFormat = "20060102T150405Z"
+)
+
+// collectorConfig is everything one invocation needs. It's merged from the function's environment,
+// then the message body, then the message attributes, each overriding what came before.
+type collectorConfig struct {
+	Action   string
+	SiteIDs  []string
+	TimeUnit string
+	// Window is how far back to start when there's no checkpoint to go on.
+	Window time.Duration
+	// FromInstallation starts anything without a checkpoint at its site's installation date
+	// instead of Window back.
+	FromInstallation bool
+	// StartTime, when set, overrides the checkpoint, for backfills.
+	StartTime time.Time
+	EndTime   time.Time
+
+	BucketName   string
+	BucketPrefix string
+	APIKeySecret string
+	// Storage is where fetched data goes, as a storage.Open URI; a directory runs the collector
+	// locally, writing to disk.
+	Storage string
+	// Checkpoints is where checkpoints are kept, as a checkpoint.Open URI.
+	Checkpoints string
+	// Layout is how objects are laid out in storage; see storage.DefaultLayout.
+	Layout *storage.Layout
+
+	// RunID names the run's manifest; it's the message ID, so a redelivered message's manifest
+	// replaces the first one's.
+	RunID string
+}
+
+// messageBody is the JSON a message may carry; every field is optional.
+type messageBody struct {
+	Action    string   `json:"action"`
+	SiteIDs   []string `json:"siteIds"`
+	TimeUnit  string   `json:"timeUnit"`
+	Window    string   `json:"window"`
+	StartTime string   `json:"startTime"`
+	EndTime   string   `json:"endTime"`
+}
+
+// splitList reads comma-separated lists, ignoring blanks and spaces around entries.
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// loadConfig merges the function's environment with a message. The config is returned even when
+// it doesn't validate, so callers can log what they were given.
+func loadConfig(getenv func(string) string, message events.SQSMessage, now time.Time) (*collectorConfig, error) {
+	config := &collectorConfig{
+		Action:       getenv(envAction),
+		SiteIDs:      splitList(getenv(envSiteIDs)),
+		TimeUnit:     getenv(envTimeUnit),
+		Window:       defaultWindow,
+		EndTime:      now,
+		BucketName:   getenv(envBucketName),
+		BucketPrefix: getenv(envBucketPrefix),
+		APIKeySecret: getenv(envAPIKeySecret),
+		Storage:      getenv(envStorage),
+		Checkpoints:  getenv(envCheckpoints),
+		RunID:        message.MessageId,
+	}
+	var errs error
+
+	layout := getenv(envKeyLayout)
+	if layout == "" {
+		layout = storage.DefaultLayout
+	}
+	var err error
+	if config.Layout, err = storage.ParseLayout(layout); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("%s: %w", envKeyLayout, err))
+	}
+	if config.RunID == "" {
+		config.RunID = now.UTC().Format(runIDTimeFormat)
+	}
+
+	window := getenv(envWindow)
+
+	if body := strings.TrimSpace(message.Body); body != "" {
+		var b messageBody
+		err := json.Unmarshal([]byte(body), &b)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("message body isn't valid JSON: %w", err))
+		}
+		if b.Action != "" {
+			config.Action = b.Action
+		}
+		if len(b.SiteIDs) > 0 {
+			config.SiteIDs = b.SiteIDs
+		}
+		if b.TimeUnit != "" {
+			config.TimeUnit = b.TimeUnit
+		}
+		if b.Window != "" {
+			window = b.Window
+		}
+		if b.StartTime != "" {
+			if config.StartTime, err = checkpoint.Parse(b.StartTime); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("startTime could not be parsed: %w", err))
+			}
+		}
+		if b.EndTime != "" {
+			if config.EndTime, err = checkpoint.Parse(b.EndTime); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("endTime could not be parsed: %w", err))
+			}
+		}
+	}
+
+	if v, ok := attributeValue(message, attributeAction); ok {
+		config.Action = v
+	}
+	if attribute, ok := message.MessageAttributes[attributeSiteIDs]; ok {
+		if len(attribute.StringListValues) > 0 {
+			config.SiteIDs = attribute.StringListValues
+		} else if attribute.StringValue != nil {
+			config.SiteIDs = splitList(*attribute.StringValue)
+		}
+	}
+	if v, ok := attributeValue(message, attributeTimeUnit); ok {
+		config.TimeUnit = v
+	}
+	if v, ok := attributeValue(message, attributeWindow); ok {
+		window = v
+	}
+
+	if window == windowInstallation {
+		config.FromInstallation = true
+	} else if window != "" {
+		if config.Window, err = time.ParseDuration(window); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("window could not be parsed: %w", err))
+		} else if config.Window <= 0 {
+			errs = multierror.Append(errs, fmt.Errorf("window must be positive, not %s", window))
+		}
+	}
+
+	switch config.Action {
+	case actionEnergy:
+		if config.TimeUnit == "" {
+			config.TimeUnit = api.TimeUnitHour
+		}
+		if window == "" {
+			config.FromInstallation = true
+		}
+	case actionTelemetry:
+		if config.TimeUnit == "" {
+			config.TimeUnit = api.TimeUnitQuarterHour
+		}
+	case "":
+		errs = multierror.Append(errs, fmt.Errorf("no action; set %s, or action in the message body or attributes", envAction))
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("unknown action %q, expected %s or %s", config.Action, actionEnergy, actionTelemetry))
+	}
+
+	switch config.TimeUnit {
+	case "", api.TimeUnitDay, api.TimeUnitHour, api.TimeUnitQuarterHour:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("unknown time unit %q, expected %s, %s or %s", config.TimeUnit, api.TimeUnitDay, api.TimeUnitHour, api.TimeUnitQuarterHour))
+	}
+
+	if !config.StartTime.IsZero() && !config.StartTime.Before(config.EndTime) {
+		errs = multierror.Append(errs, errors.New("startTime must be before endTime"))
+	}
+	if config.BucketName != "" {
+		bucket := "s3://" + path.Join(config.BucketName, config.BucketPrefix)
+		if config.Storage == "" {
+			config.Storage = bucket
+		}
+		if config.Checkpoints == "" {
+			config.Checkpoints = bucket
+		}
+	}
+	if config.Storage == "" {
+		errs = multierror.Append(errs, fmt.Errorf("nowhere to store data; set %s, or %s to a directory", envBucketName, envStorage))
+	} else if config.Checkpoints == "" {
+		// the checkpoints can live with the data: in a file next to it locally, or under the same
+		// prefix in S3, where the store keeps an object per checkpoint.
+		if strings.HasPrefix(config.Storage, "s3://") {
+			config.Checkpoints = config.Storage
+		} else {
+			config.Checkpoints = strings.TrimSuffix(config.Storage, "/") + "/checkpoints.json"
+		}
+	}
+	if config.APIKeySecret == "" {
+		errs = multierror.Append(errs, fmt.Errorf("no API key secret; set %s", envAPIKeySecret))
+	}
+
+	return config, errs
+}
+
+// attributeValue gets a string message attribute, ignoring blank ones.
+func attributeValue(message events.SQSMessage, name string) (string, bool) {
+	attribute, ok := message.MessageAttributes[name]
+	if !ok || attribute.StringValue == nil || strings.TrimSpace(*attribute.StringValue) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(*attribute.StringValue), true
+}
+
+// incrementalConfig runs from each checkpoint, or the window back from the end or the installation
+// date for anything new. An explicit start time is a backfill, from there whatever the checkpoints say.
+func (c *collectorConfig) incrementalConfig() *action.IncrementalConfig {
+	config := &action.IncrementalConfig{
+		TimeUnit:         c.TimeUnit,
+		StartTime:        c.EndTime.Add(-c.Window),
+		EndTime:          c.EndTime,
+		FromInstallation: c.FromInstallation,
+		SiteIDs:          c.SiteIDs,
+		DiscoverSites:    len(c.SiteIDs) == 0,
+	}
+	if !c.StartTime.IsZero() {
+		config.StartTime = c.StartTime
+		config.Backfill = true
+	}
+	return config
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2021, 11, 2, 12, 0, 0, 0, time.UTC)
+
+func testEnv(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+func baseEnv() map[string]string {
+	return map[string]string{
+		envBucketName:   "bucket",
+		envAPIKeySecret: "solaredge-api-key",
+		envSiteIDs:      " 12345, ,67890 ",
+		envAction:       actionEnergy,
+	}
+}
+
+func TestLoadConfigFromEnvironment(t *testing.T) {
+	config, err := loadConfig(testEnv(baseEnv()), events.SQSMessage{}, testNow)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, actionEnergy, config.Action)
+	assert.Equal(t, []string{"12345", "67890"}, config.SiteIDs)
+	assert.Equal(t, api.TimeUnitHour, config.TimeUnit)
+	assert.Equal(t, defaultWindow, config.Window)
+	assert.True(t, testNow.Equal(config.EndTime))
+	assert.Equal(t, "s3://bucket", config.Storage)
+	assert.Equal(t, "s3://bucket", config.Checkpoints)
+
+	incremental := config.incrementalConfig()
+	assert.True(t, testNow.Add(-defaultWindow).Equal(incremental.StartTime))
+	assert.True(t, incremental.FromInstallation, "new sites' energy should start at installation without a window")
+	assert.False(t, incremental.Backfill)
+	assert.False(t, incremental.DiscoverSites)
+
+	env := baseEnv()
+	env[envAction] = actionTelemetry
+	config, err = loadConfig(testEnv(env), events.SQSMessage{}, testNow)
+	if assert.NoError(t, err) {
+		assert.False(t, config.FromInstallation, "telemetry should only go back the default window")
+	}
+	env[envWindow] = windowInstallation
+	config, err = loadConfig(testEnv(env), events.SQSMessage{}, testNow)
+	if assert.NoError(t, err) {
+		assert.True(t, config.FromInstallation)
+	}
+}
+
+func TestLoadConfigLocally(t *testing.T) {
+	env := baseEnv()
+	delete(env, envBucketName)
+	env[envStorage] = "file:///var/lib/solaredge/"
+
+	config, err := loadConfig(testEnv(env), events.SQSMessage{}, testNow)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "file:///var/lib/solaredge/", config.Storage)
+		assert.Equal(t, "file:///var/lib/solaredge/checkpoints.json", config.Checkpoints, "checkpoints should live with the data")
+	}
+
+	// lambda-local against a bucket sets storage rather than a bucket name.
+	env[envStorage] = "s3://bucket/prefix"
+	config, err = loadConfig(testEnv(env), events.SQSMessage{}, testNow)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "s3://bucket/prefix", config.Checkpoints, "S3 checkpoints should go under the storage prefix, not a file name")
+	}
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	message := events.SQSMessage{
+		Body: `{"action": "energy", "siteIds": ["1"], "timeUnit": "DAY", "window": "72h", "startTime": "2021-10-01T00:00:00Z"}`,
+		MessageAttributes: map[string]events.SQSMessageAttribute{
+			attributeAction:  {StringValue: aws.String("telemetry"), DataType: "String"},
+			attributeSiteIDs: {StringValue: aws.String("2,3"), DataType: "String"},
+		},
+	}
+
+	config, err := loadConfig(testEnv(baseEnv()), message, testNow)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, actionTelemetry, config.Action, "attributes should override the body")
+	assert.Equal(t, []string{"2", "3"}, config.SiteIDs)
+	assert.Equal(t, api.TimeUnitDay, config.TimeUnit, "the body should override the environment")
+	assert.Equal(t, 72*time.Hour, config.Window)
+	assert.False(t, config.FromInstallation, "a window should win over the installation date")
+
+	start := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	incremental := config.incrementalConfig()
+	assert.True(t, start.Equal(incremental.StartTime))
+	assert.True(t, incremental.Backfill, "an explicit start should win over the checkpoints")
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	message := events.SQSMessage{
+		Body: `{"action": "inverters", "timeUnit": "WEEK", "window": "-1h", "startTime": "2021-12-01T00:00:00Z"}`,
+	}
+
+	_, err := loadConfig(testEnv(map[string]string{}), message, testNow)
+	if !assert.Error(t, err) {
+		return
+	}
+	for _, expected := range []string{
+		`unknown action "inverters"`,
+		`unknown time unit "WEEK"`,
+		"window must be positive",
+		"startTime must be before endTime",
+		envBucketName,
+		envAPIKeySecret,
+	} {
+		assert.Contains(t, err.Error(), expected)
+	}
+
+	_, err = loadConfig(testEnv(baseEnv()), events.SQSMessage{Body: "{"}, testNow)
+	assert.Error(t, err, "a body that isn't JSON should be rejected")
+
+	env := baseEnv()
+	env[envKeyLayout] = "dataset={dataset}/hour={hour}"
+	_, err = loadConfig(testEnv(env), events.SQSMessage{}, testNow)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown placeholder {hour}")
+	}
+}
@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// eventProbe is just enough of an event to tell what sort it is.
+type eventProbe struct {
+	Records    []json.RawMessage `json:"Records"`
+	DetailType string            `json:"detail-type"`
+}
+
+// scheduleInput is what an EventBridge rule can pass as its input, on top of messageBody's fields,
+// like {"actions": ["energy", "telemetry"], "window": "48h"} to collect yesterday's data nightly.
+type scheduleInput struct {
+	// Actions runs each of these in turn, rather than the one action a message names.
+	Actions []string `json:"actions"`
+}
+
+// decodeEvent tells SQS batches from EventBridge events. A schedule without input sends an event
+// whose detail may carry the input; a rule with constant input sends that JSON on its own, so
+// anything else is taken to be that. Constant input has no event ID, so its runs are named by id,
+// which has to differ from one invocation to the next.
+func decodeEvent(payload []byte, id string) (*events.SQSEvent, []events.SQSMessage, error) {
+	var probe eventProbe
+	err := json.Unmarshal(payload, &probe)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to decode event: %w", err)
+	}
+
+	if len(probe.Records) > 0 {
+		event := &events.SQSEvent{}
+		err = json.Unmarshal(payload, event)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to decode SQS event: %w", err)
+		}
+		return event, nil, nil
+	}
+
+	if probe.DetailType != "" {
+		var event events.CloudWatchEvent
+		err = json.Unmarshal(payload, &event)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to decode EventBridge event: %w", err)
+		}
+		if event.ID != "" {
+			id = event.ID
+		}
+		messages, err := scheduledMessages(id, event.Detail)
+		return nil, messages, err
+	}
+
+	messages, err := scheduledMessages(id, payload)
+	return nil, messages, err
+}
+
+// scheduledMessages turns a schedule's input into a message per action, so the input is read the
+// same way a message body is.
+func scheduledMessages(id string, input json.RawMessage) ([]events.SQSMessage, error) {
+	body := strings.TrimSpace(string(input))
+	if body == "" || body == "null" {
+		return []events.SQSMessage{{MessageId: id}}, nil
+	}
+
+	var schedule scheduleInput
+	err := json.Unmarshal([]byte(body), &schedule)
+	if err != nil {
+		return nil, fmt.Errorf("schedule input isn't valid JSON: %w", err)
+	}
+	if len(schedule.Actions) == 0 {
+		return []events.SQSMessage{{MessageId: id, Body: body}}, nil
+	}
+
+	messages := make([]events.SQSMessage, 0, len(schedule.Actions))
+	for _, name := range schedule.Actions {
+		if name == "" {
+			return nil, errors.New("schedule input has an empty action")
+		}
+		messages = append(messages, events.SQSMessage{
+			MessageId: fmt.Sprintf("%s/%s", id, name),
+			Body:      body,
+			MessageAttributes: map[string]events.SQSMessageAttribute{
+				attributeAction: {StringValue: aws.String(name), DataType: "String"},
+			},
+		})
+	}
+	return messages, nil
+}
+
+// NewSQSEvent is a batch like the queue would deliver, a message per body, for running the
+// collector without one.
+func NewSQSEvent(id string, bodies ...[]byte) events.SQSEvent {
+	event := events.SQSEvent{Records: make([]events.SQSMessage, 0, len(bodies))}
+	for i, body := range bodies {
+		messageID := id
+		if len(bodies) > 1 {
+			messageID = fmt.Sprintf("%s-%d", id, i+1)
+		}
+		event.Records = append(event.Records, events.SQSMessage{
+			MessageId:   messageID,
+			Body:        string(body),
+			EventSource: "aws:sqs",
+		})
+	}
+	return event
+}
+
+// NewScheduledEvent is what an EventBridge schedule sends when input is its detail.
+func NewScheduledEvent(id string, input []byte, now time.Time) events.CloudWatchEvent {
+	return events.CloudWatchEvent{
+		ID:         id,
+		DetailType: "Scheduled Event",
+		Source:     "aws.events",
+		Time:       now,
+		Detail:     input,
+	}
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeSQSEvent(t *testing.T) {
+	sqsEvent, scheduled, err := decodeEvent([]byte(`{"Records": [{"messageId": "m1", "eventSource": "aws:sqs", "body": "{\"action\": \"energy\"}"}]}`), "invocation")
+	if !assert.NoError(t, err) || !assert.NotNil(t, sqsEvent) {
+		return
+	}
+	assert.Nil(t, scheduled)
+	if assert.Len(t, sqsEvent.Records, 1) {
+		assert.Equal(t, "m1", sqsEvent.Records[0].MessageId)
+	}
+}
+
+func TestDecodeScheduledEvent(t *testing.T) {
+	sqsEvent, scheduled, err := decodeEvent([]byte(`{
+		"id": "e1",
+		"detail-type": "Scheduled Event",
+		"source": "aws.events",
+		"detail": {"actions": ["energy", "telemetry"], "siteIds": ["12345"], "window": "48h"}
+	}`), "invocation")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Nil(t, sqsEvent)
+	if !assert.Len(t, scheduled, 2) {
+		return
+	}
+	assert.Equal(t, "e1/energy", scheduled[0].MessageId)
+
+	config, err := loadConfig(testEnv(baseEnv()), scheduled[1], testNow)
+	if assert.NoError(t, err) {
+		assert.Equal(t, actionTelemetry, config.Action, "each action should get a config of its own")
+		assert.Equal(t, []string{"12345"}, config.SiteIDs)
+		assert.Equal(t, "48h0m0s", config.Window.String())
+	}
+	config, err = loadConfig(testEnv(baseEnv()), scheduled[0], testNow)
+	if assert.NoError(t, err) {
+		assert.Equal(t, actionEnergy, config.Action)
+	}
+
+	_, scheduled, err = decodeEvent([]byte(`{"detail-type": "Scheduled Event", "source": "aws.events", "detail": {}}`), "invocation")
+	if assert.NoError(t, err) && assert.Len(t, scheduled, 1) {
+		config, err := loadConfig(testEnv(baseEnv()), scheduled[0], testNow)
+		assert.NoError(t, err)
+		assert.Equal(t, actionEnergy, config.Action, "a schedule without input should fall back to the environment")
+	}
+}
+
+func TestDecodeConstantInput(t *testing.T) {
+	sqsEvent, scheduled, err := decodeEvent([]byte(`{"action": "telemetry", "timeUnit": "QUARTER_OF_AN_HOUR"}`), "invocation")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Nil(t, sqsEvent)
+	if assert.Len(t, scheduled, 1) {
+		assert.Equal(t, "invocation", scheduled[0].MessageId, "constant input has no event ID, so the invocation's should be used")
+		config, err := loadConfig(testEnv(baseEnv()), scheduled[0], testNow)
+		assert.NoError(t, err)
+		assert.Equal(t, actionTelemetry, config.Action)
+	}
+
+	_, _, err = decodeEvent([]byte(`{"actions": ["energy", ""]}`), "invocation")
+	assert.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/storage"
+)
+
+// energyRow is a line of an energy object. Site and dataset are left to the partitions, since
+// Athena won't have a column and a partition with the same name.
+type energyRow struct {
+	Date     api.Timestamp `json:"date"`
+	Value    int64         `json:"value"`
+	Unit     string        `json:"unit"`
+	TimeUnit string        `json:"timeUnit"`
+}
+
+// writeEnergy merges the periods with values into an object per site-local day.
+func writeEnergy(writer *storage.PartitionWriter, siteID string, energy *api.Energy) error {
+	var rows []storage.Row
+	for _, v := range energy.Values {
+		if v.Value != nil {
+			rows = append(rows, storage.Row{Time: v.Date.Time, Data: energyRow{Date: v.Date, Value: *v.Value, Unit: energy.Unit, TimeUnit: energy.TimeUnit}})
+		}
+	}
+	return writeDays(writer, storage.Partition{SiteID: siteID}, rows)
+}
+
+// writeTelemetry merges telemetry into an object per site-local day, a telemetry to a line.
+func writeTelemetry(writer *storage.PartitionWriter, siteID, serial string, telemetries []api.Telemetry) error {
+	rows := make([]storage.Row, 0, len(telemetries))
+	for _, t := range telemetries {
+		rows = append(rows, storage.Row{Time: t.Date.Time, Data: t})
+	}
+	return writeDays(writer, storage.Partition{SiteID: siteID, Serial: serial}, rows)
+}
+
+// writeDays splits rows by the day they fall in. Times are in the site's zone, so that's the
+// site's day, and every run puts a period in the same object.
+func writeDays(writer *storage.PartitionWriter, p storage.Partition, rows []storage.Row) error {
+	var days []time.Time
+	byDay := make(map[time.Time][]storage.Row)
+	for _, row := range rows {
+		start, _ := storage.DayOf(row.Time)
+		if _, ok := byDay[start]; !ok {
+			days = append(days, start)
+		}
+		byDay[start] = append(byDay[start], row)
+	}
+
+	for _, day := range days {
+		p.Start, p.End = storage.DayOf(day)
+		err := writer.WriteRows(p, byDay[day])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteEnergy(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if !assert.NoError(t, err) {
+		return
+	}
+	layout, err := storage.ParseLayout(storage.DefaultLayout)
+	if !assert.NoError(t, err) {
+		return
+	}
+	store := storage.NewMemoryStore()
+	writer := storage.NewPartitionWriter(store, layout, actionEnergy, "run", testNow)
+
+	value := int64(100)
+	evening := time.Date(2021, 11, 1, 23, 0, 0, 0, la)
+	energy := &api.Energy{
+		TimeUnit: api.TimeUnitHour,
+		Unit:     "Wh",
+		Values: []api.Value{
+			{Date: api.Timestamp{Time: evening}, Value: &value},
+			{Date: api.Timestamp{Time: evening.Add(time.Hour)}, Value: &value},
+			{Date: api.Timestamp{Time: evening.Add(2 * time.Hour)}},
+		},
+	}
+	if !assert.NoError(t, writeEnergy(writer, "12345", energy)) {
+		return
+	}
+
+	manifest, err := writer.Finish(testNow)
+	if !assert.NoError(t, err) || !assert.Len(t, manifest.Objects, 2, "periods either side of midnight should go in each site-local day's object") {
+		return
+	}
+	assert.Equal(t, "dataset=energy/site=12345/year=2021/month=11/day=01/20211101T070000Z_20211102T070000Z.json", manifest.Objects[0].Key)
+	assert.Equal(t, "dataset=energy/site=12345/year=2021/month=11/day=02/20211102T070000Z_20211103T070000Z.json", manifest.Objects[1].Key)
+	assert.Equal(t, 1, manifest.Objects[1].Rows, "periods without values should be left out")
+
+	data, _, err := store.Get(manifest.Objects[0].Key)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `{"date":"2021-11-01T23:00:00-07:00","value":100,"unit":"Wh","timeUnit":"HOUR"}`+"\n", string(data))
+	}
+}
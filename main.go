@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	_ "time/tzdata" // timestamps are read in each site's zone, which has to load wherever the CLI is copied to
 
 	"github.com/dreamlibrarian/solaredge-monitoring/cmd"
 )
@@ -0,0 +1,206 @@
+// Package metrics exposes the current state of sites as Prometheus gauges.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	namespace = "solaredge"
+
+	labelSiteID = "site_id"
+	labelSerial = "serial"
+	labelMode   = "mode"
+
+	// DefaultDailyRequestBudget is the monitoring API's daily limit per site.
+	DefaultDailyRequestBudget = 300
+)
+
+// Exporter keeps the gauges up to date from site snapshots.
+type Exporter struct {
+	registry *prometheus.Registry
+	gauges   *snapshotCollector
+
+	currentPower          *prometheus.Desc
+	todayEnergy           *prometheus.Desc
+	lifetimeEnergy        *prometheus.Desc
+	temperature           *prometheus.Desc
+	dcVoltage             *prometheus.Desc
+	groundFaultResistance *prometheus.Desc
+	inverterMode          *prometheus.Desc
+
+	lastRefresh   prometheus.Gauge
+	refreshErrors prometheus.Counter
+}
+
+func NewExporter() *Exporter {
+	inverterLabels := []string{labelSiteID, labelSerial}
+	name := func(name string) string {
+		return prometheus.BuildFQName(namespace, "", name)
+	}
+
+	e := &Exporter{
+		registry: prometheus.NewRegistry(),
+
+		currentPower: prometheus.NewDesc(name("current_power_watts"),
+			"Total active power of the inverter at its latest reading.", inverterLabels, nil),
+		todayEnergy: prometheus.NewDesc(name("today_energy_watt_hours"),
+			"Energy produced by the site so far today, in the site's time zone.", []string{labelSiteID}, nil),
+		lifetimeEnergy: prometheus.NewDesc(name("lifetime_energy_watt_hours"),
+			"Total energy produced by the inverter over its lifetime.", inverterLabels, nil),
+		temperature: prometheus.NewDesc(name("inverter_temperature_celsius"),
+			"Inverter heat sink temperature.", inverterLabels, nil),
+		dcVoltage: prometheus.NewDesc(name("dc_voltage_volts"),
+			"Inverter DC input voltage.", inverterLabels, nil),
+		groundFaultResistance: prometheus.NewDesc(name("ground_fault_resistance_kiloohms"),
+			"Inverter ground fault resistance.", inverterLabels, nil),
+		inverterMode: prometheus.NewDesc(name("inverter_mode"),
+			"Set to 1 for the inverter's current mode, e.g. MPPT, SLEEPING or FAULT.", []string{labelSiteID, labelSerial, labelMode}, nil),
+
+		lastRefresh: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_refresh_timestamp_seconds",
+			Help:      "When the gauges were last successfully refreshed from the API.",
+		}),
+		refreshErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "refresh_errors_total",
+			Help:      "How many refreshes from the API have failed.",
+		}),
+	}
+	e.gauges = &snapshotCollector{descs: []*prometheus.Desc{
+		e.currentPower,
+		e.todayEnergy,
+		e.lifetimeEnergy,
+		e.temperature,
+		e.dcVoltage,
+		e.groundFaultResistance,
+		e.inverterMode,
+	}}
+
+	e.registry.MustRegister(
+		e.gauges,
+		e.lastRefresh,
+		e.refreshErrors,
+	)
+
+	return e
+}
+
+func (e *Exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{})
+}
+
+// Update replaces the gauges with what's in the snapshots. Sites or inverters missing from them
+// drop out rather than reporting stale values forever. The new gauges are built up first and
+// swapped in whole, so a scrape sees either the last refresh or this one, never a mix or a gap.
+func (e *Exporter) Update(snapshots map[string]*action.SiteSnapshot, at time.Time) {
+	var metrics []prometheus.Metric
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+		metrics = append(metrics, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...))
+	}
+
+	for siteID, snapshot := range snapshots {
+		if snapshot.TodayEnergy != nil {
+			gauge(e.todayEnergy, *snapshot.TodayEnergy, siteID)
+		}
+		for serial, t := range snapshot.Inverters {
+			gauge(e.currentPower, t.TotalActivePower, siteID, serial)
+			gauge(e.lifetimeEnergy, t.TotalEnergy, siteID, serial)
+			gauge(e.temperature, t.Temperature, siteID, serial)
+			gauge(e.dcVoltage, t.DCVoltage, siteID, serial)
+			gauge(e.groundFaultResistance, t.GroundFaultResistance, siteID, serial)
+			if t.InverterMode != "" {
+				gauge(e.inverterMode, 1, siteID, serial, t.InverterMode)
+			}
+		}
+	}
+
+	e.gauges.swap(metrics)
+	e.lastRefresh.Set(float64(at.Unix()))
+}
+
+// snapshotCollector serves the gauges from the last Update, which are never changed once made.
+type snapshotCollector struct {
+	descs []*prometheus.Desc
+
+	lock    sync.RWMutex
+	metrics []prometheus.Metric
+}
+
+func (c *snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+func (c *snapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.RLock()
+	metrics := c.metrics
+	c.lock.RUnlock()
+	for _, metric := range metrics {
+		ch <- metric
+	}
+}
+
+func (c *snapshotCollector) swap(metrics []prometheus.Metric) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.metrics = metrics
+}
+
+// RefreshInterval spaces refreshes out so that requestsPerRefresh calls, made every interval,
+// stay inside the daily budget for each site. It never goes below minimum.
+func RefreshInterval(requestsPerRefresh, dailyBudget int, minimum time.Duration) time.Duration {
+	if requestsPerRefresh <= 0 || dailyBudget <= 0 {
+		return minimum
+	}
+	interval := 24 * time.Hour * time.Duration(requestsPerRefresh) / time.Duration(dailyBudget)
+	if interval < minimum {
+		return minimum
+	}
+	return interval
+}
+
+// Run refreshes until the context is done, working out the interval from how many requests each
+// refresh took. The first refresh happens straight away.
+func (e *Exporter) Run(ctx context.Context, refresh func() (map[string]*action.SiteSnapshot, error), dailyBudget int, minimum time.Duration) {
+	// on failure we wait out whatever interval we last had, rather than hammering a struggling API.
+	interval := minimum
+	for {
+		snapshots, err := refresh()
+		if err != nil {
+			log.Error().Err(err).Msg("unable to refresh metrics")
+			e.refreshErrors.Inc()
+		}
+		// sites that did refresh are still worth serving when others failed.
+		if err == nil || len(snapshots) > 0 {
+			e.Update(snapshots, time.Now())
+
+			// the budget is per site, so the busiest site sets the pace.
+			var requests int
+			for _, snapshot := range snapshots {
+				if snapshot.Requests > requests {
+					requests = snapshot.Requests
+				}
+			}
+			interval = RefreshInterval(requests, dailyBudget, minimum)
+		}
+
+		log.Debug().Dur("interval", interval).Msg("next metrics refresh scheduled")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
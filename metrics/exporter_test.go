@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExporterUpdate(t *testing.T) {
+	var telemetry api.Telemetry
+	err := json.Unmarshal([]byte(`{"date":"2021-11-23 08:43:41","totalActivePower":2075.03,"dcVoltage":415.7,
+		"groundFaultResistance":11000,"totalEnergy":1199,"temperature":25.8403,"inverterMode":"MPPT"}`), &telemetry)
+	if !assert.NoError(t, err) {
+		return
+	}
+	today := 4321.0
+
+	e := NewExporter()
+	e.Update(map[string]*action.SiteSnapshot{
+		"12345": {
+			SiteID:      "12345",
+			TodayEnergy: &today,
+			Inverters:   map[string]*api.Telemetry{"7E1234AB-12": &telemetry},
+		},
+	}, time.Unix(1637686000, 0))
+
+	recorder := httptest.NewRecorder()
+	e.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+
+	for _, expected := range []string{
+		`solaredge_current_power_watts{serial="7E1234AB-12",site_id="12345"} 2075.03`,
+		`solaredge_today_energy_watt_hours{site_id="12345"} 4321`,
+		`solaredge_lifetime_energy_watt_hours{serial="7E1234AB-12",site_id="12345"} 1199`,
+		`solaredge_inverter_temperature_celsius{serial="7E1234AB-12",site_id="12345"} 25.8403`,
+		`solaredge_dc_voltage_volts{serial="7E1234AB-12",site_id="12345"} 415.7`,
+		`solaredge_ground_fault_resistance_kiloohms{serial="7E1234AB-12",site_id="12345"} 11000`,
+		`solaredge_inverter_mode{mode="MPPT",serial="7E1234AB-12",site_id="12345"} 1`,
+		`solaredge_last_refresh_timestamp_seconds 1.637686e+09`,
+	} {
+		assert.Contains(t, string(body), expected)
+	}
+
+	e.Update(map[string]*action.SiteSnapshot{}, time.Now())
+	recorder = httptest.NewRecorder()
+	e.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ = ioutil.ReadAll(recorder.Body)
+	assert.NotContains(t, string(body), "solaredge_current_power_watts{", "sites that drop out should drop their gauges")
+}
+
+func TestRefreshInterval(t *testing.T) {
+	assert.Equal(t, 24*time.Minute, RefreshInterval(5, 300, time.Minute))
+	assert.Equal(t, 10*time.Minute, RefreshInterval(1, 300, 10*time.Minute), "should never go below the minimum")
+	assert.Equal(t, time.Minute, RefreshInterval(0, 300, time.Minute))
+}
+
+func TestExporterUpdateWhileScraping(t *testing.T) {
+	telemetry := &api.Telemetry{TotalActivePower: 2075.03}
+	snapshots := map[string]*action.SiteSnapshot{
+		"12345": {SiteID: "12345", Inverters: map[string]*api.Telemetry{"7E1234AB-12": telemetry}},
+	}
+
+	e := NewExporter()
+	e.Update(snapshots, time.Now())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			e.Update(snapshots, time.Now())
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		recorder := httptest.NewRecorder()
+		e.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		body, _ := ioutil.ReadAll(recorder.Body)
+		if !assert.Contains(t, string(body), `solaredge_current_power_watts{serial="7E1234AB-12",site_id="12345"} 2075.03`, "a scrape during an update shouldn't see gauges missing") {
+			break
+		}
+	}
+	<-done
+}
@@ -0,0 +1,283 @@
+// Package mqtt publishes the current state of sites to an MQTT broker, announcing each sensor to
+// Home Assistant through its MQTT discovery protocol.
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/dreamlibrarian/solaredge-monitoring/metrics"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultTopicPrefix     = "solaredge"
+	DefaultDiscoveryPrefix = "homeassistant"
+
+	PayloadOnline  = "online"
+	PayloadOffline = "offline"
+
+	qos            = 1
+	publishTimeout = 10 * time.Second
+	manufacturer   = "SolarEdge"
+)
+
+type Options struct {
+	// TopicPrefix is where state goes: <prefix>/<site>/<sensor>, and <prefix>/<site>/<serial>/<sensor>
+	// for inverters.
+	TopicPrefix string
+	// DiscoveryPrefix is Home Assistant's discovery prefix; empty turns discovery off.
+	DiscoveryPrefix string
+}
+
+// AvailabilityTopic is where the publisher says whether it's online; the MQTT client should set
+// PayloadOffline there as its will.
+func (o Options) AvailabilityTopic() string {
+	return o.TopicPrefix + "/status"
+}
+
+// sensor is one Home Assistant sensor: a state topic, and what to tell discovery about it.
+type sensor struct {
+	objectID    string
+	name        string
+	unit        string
+	deviceClass string
+	stateClass  string
+	stateTopic  string
+	device      device
+	state       string
+}
+
+type device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	ViaDevice    string   `json:"via_device,omitempty"`
+}
+
+type discoveryConfig struct {
+	Name              string `json:"name"`
+	UniqueID          string `json:"unique_id"`
+	StateTopic        string `json:"state_topic"`
+	AvailabilityTopic string `json:"availability_topic"`
+	UnitOfMeasurement string `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string `json:"device_class,omitempty"`
+	StateClass        string `json:"state_class,omitempty"`
+	Device            device `json:"device"`
+}
+
+// Publisher turns site snapshots into retained MQTT messages.
+type Publisher struct {
+	client  paho.Client
+	options Options
+
+	// announced holds the discovery topics already sent; they're retained, so once is enough.
+	announced map[string]bool
+}
+
+func NewPublisher(client paho.Client, options Options) *Publisher {
+	return &Publisher{
+		client:    client,
+		options:   options,
+		announced: make(map[string]bool),
+	}
+}
+
+var unsafeTopicChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// topicSafe keeps serials like 7E1234AB-12 usable as topic levels and discovery object IDs.
+func topicSafe(s string) string {
+	return unsafeTopicChars.ReplaceAllString(s, "_")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// sensors works out every sensor a snapshot has a state for. Current power comes from the power
+// flow when there is one, since it covers every inverter, and from summing inverter telemetry otherwise.
+func (p *Publisher) sensors(snapshot *action.SiteSnapshot) []sensor {
+	siteID := topicSafe(snapshot.SiteID)
+	siteTopic := p.options.TopicPrefix + "/" + siteID
+	site := device{
+		Identifiers:  []string{"solaredge_" + siteID},
+		Name:         "SolarEdge site " + snapshot.SiteID,
+		Manufacturer: manufacturer,
+	}
+	siteSensor := func(objectID, name, unit, deviceClass, stateClass, state string) sensor {
+		return sensor{
+			objectID:    objectID,
+			name:        name,
+			unit:        unit,
+			deviceClass: deviceClass,
+			stateClass:  stateClass,
+			stateTopic:  siteTopic + "/" + objectID,
+			device:      site,
+			state:       state,
+		}
+	}
+
+	var result []sensor
+
+	flow := snapshot.PowerFlow
+	if flow != nil && flow.PV != nil {
+		result = append(result, siteSensor("current_power", "Current power", "W", "power", "measurement", formatFloat(flow.Watts(flow.PV.CurrentPower))))
+	} else if len(snapshot.Inverters) > 0 {
+		var power float64
+		for _, telemetry := range snapshot.Inverters {
+			power += telemetry.TotalActivePower
+		}
+		result = append(result, siteSensor("current_power", "Current power", "W", "power", "measurement", formatFloat(power)))
+	}
+
+	if snapshot.TodayEnergy != nil {
+		result = append(result, siteSensor("today_energy", "Energy today", "Wh", "energy", "total_increasing", formatFloat(*snapshot.TodayEnergy)))
+	}
+
+	if flow != nil && flow.Storage != nil {
+		if flow.Storage.ChargeLevel != nil {
+			result = append(result, siteSensor("battery_level", "Battery level", "%", "battery", "measurement", formatFloat(*flow.Storage.ChargeLevel)))
+		}
+		result = append(result, siteSensor("battery_status", "Battery status", "", "", "", flow.Storage.Status))
+	}
+
+	for serial, telemetry := range snapshot.Inverters {
+		safeSerial := topicSafe(serial)
+		inverter := device{
+			Identifiers:  []string{"solaredge_" + safeSerial},
+			Name:         "SolarEdge inverter " + serial,
+			Manufacturer: manufacturer,
+			ViaDevice:    site.Identifiers[0],
+		}
+		inverterTopic := siteTopic + "/" + safeSerial
+		result = append(result,
+			sensor{
+				objectID:    safeSerial + "_power",
+				name:        "Power",
+				unit:        "W",
+				deviceClass: "power",
+				stateClass:  "measurement",
+				stateTopic:  inverterTopic + "/power",
+				device:      inverter,
+				state:       formatFloat(telemetry.TotalActivePower),
+			},
+			sensor{
+				objectID:   safeSerial + "_status",
+				name:       "Status",
+				stateTopic: inverterTopic + "/status",
+				device:     inverter,
+				state:      telemetry.InverterMode,
+			},
+		)
+	}
+
+	return result
+}
+
+func (p *Publisher) publish(topic string, payload []byte) error {
+	token := p.client.Publish(topic, qos, true, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("unable to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Announce marks the publisher online.
+func (p *Publisher) Announce() error {
+	return p.publish(p.options.AvailabilityTopic(), []byte(PayloadOnline))
+}
+
+// Update publishes every sensor's state, announcing any new sensors to Home Assistant first so
+// the state has somewhere to land.
+func (p *Publisher) Update(snapshots map[string]*action.SiteSnapshot) error {
+	for _, snapshot := range snapshots {
+		for _, s := range p.sensors(snapshot) {
+			if p.options.DiscoveryPrefix != "" {
+				err := p.discover(s)
+				if err != nil {
+					return err
+				}
+			}
+			err := p.publish(s.stateTopic, []byte(s.state))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) discover(s sensor) error {
+	topic := fmt.Sprintf("%s/sensor/%s/%s/config", p.options.DiscoveryPrefix, s.device.Identifiers[0], s.objectID)
+	if p.announced[topic] {
+		return nil
+	}
+
+	payload, err := json.Marshal(discoveryConfig{
+		Name:              s.name,
+		UniqueID:          s.device.Identifiers[0] + "_" + s.objectID,
+		StateTopic:        s.stateTopic,
+		AvailabilityTopic: p.options.AvailabilityTopic(),
+		UnitOfMeasurement: s.unit,
+		DeviceClass:       s.deviceClass,
+		StateClass:        s.stateClass,
+		Device:            s.device,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = p.publish(topic, payload)
+	if err != nil {
+		return err
+	}
+	p.announced[topic] = true
+	return nil
+}
+
+// Run refreshes and publishes until the context is done, pacing refreshes the same way the metrics
+// exporter does, then marks the publisher offline.
+func (p *Publisher) Run(ctx context.Context, refresh func() (map[string]*action.SiteSnapshot, error), dailyBudget int, minimum time.Duration) {
+	interval := minimum
+	for {
+		snapshots, err := refresh()
+		if err != nil {
+			log.Error().Err(err).Msg("unable to refresh site state")
+		}
+		if err == nil || len(snapshots) > 0 {
+			err = p.Update(snapshots)
+			if err != nil {
+				log.Error().Err(err).Msg("unable to publish site state")
+			}
+
+			var requests int
+			for _, snapshot := range snapshots {
+				if snapshot.Requests > requests {
+					requests = snapshot.Requests
+				}
+			}
+			interval = metrics.RefreshInterval(requests, dailyBudget, minimum)
+		}
+
+		log.Debug().Dur("interval", interval).Msg("next publish scheduled")
+
+		select {
+		case <-ctx.Done():
+			err = p.publish(p.options.AvailabilityTopic(), []byte(PayloadOffline))
+			if err != nil {
+				log.Error().Err(err).Msg("unable to mark publisher offline")
+			}
+			return
+		case <-time.After(interval):
+		}
+	}
+}
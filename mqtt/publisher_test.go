@@ -0,0 +1,146 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/action"
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+)
+
+// startBroker runs an in-process broker on a free port, and collects the latest message on every topic.
+func startBroker(t *testing.T) (string, func() map[string]string) {
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if !assert.NoError(t, server.AddHook(new(auth.AllowHook), nil)) {
+		t.FailNow()
+	}
+	listener := listeners.NewTCP("test", "127.0.0.1:0", nil)
+	if !assert.NoError(t, server.AddListener(listener)) {
+		t.FailNow()
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	var lock sync.Mutex
+	messages := make(map[string]string)
+	err := server.Subscribe("#", 1, func(cl *mochi.Client, sub packets.Subscription, pk packets.Packet) {
+		lock.Lock()
+		defer lock.Unlock()
+		messages[pk.TopicName] = string(pk.Payload)
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return "tcp://" + listener.Address(), func() map[string]string {
+		lock.Lock()
+		defer lock.Unlock()
+		result := make(map[string]string, len(messages))
+		for k, v := range messages {
+			result[k] = v
+		}
+		return result
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	broker, messages := startBroker(t)
+
+	client := paho.NewClient(paho.NewClientOptions().AddBroker(broker).SetClientID("publisher-test"))
+	token := client.Connect()
+	if !assert.True(t, token.WaitTimeout(5*time.Second)) || !assert.NoError(t, token.Error()) {
+		return
+	}
+	defer client.Disconnect(100)
+
+	publisher := NewPublisher(client, Options{TopicPrefix: DefaultTopicPrefix, DiscoveryPrefix: DefaultDiscoveryPrefix})
+	assert.NoError(t, publisher.Announce())
+
+	today := 12345.0
+	charge := 61.0
+	err := publisher.Update(map[string]*action.SiteSnapshot{
+		"12345": {
+			SiteID:      "12345",
+			TodayEnergy: &today,
+			Inverters: map[string]*api.Telemetry{
+				"7E1234AB-12": {TotalActivePower: 3210.5, InverterMode: "MPPT"},
+			},
+			PowerFlow: &api.PowerFlow{
+				Unit:    "kW",
+				PV:      &api.PowerFlowElement{Status: "Active", CurrentPower: 4.62},
+				Storage: &api.PowerFlowElement{Status: "Charging", ChargeLevel: &charge},
+			},
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	expected := map[string]string{
+		"solaredge/status":                   PayloadOnline,
+		"solaredge/12345/current_power":      "4620",
+		"solaredge/12345/today_energy":       "12345",
+		"solaredge/12345/battery_level":      "61",
+		"solaredge/12345/battery_status":     "Charging",
+		"solaredge/12345/7E1234AB-12/power":  "3210.5",
+		"solaredge/12345/7E1234AB-12/status": "MPPT",
+	}
+	assert.Eventually(t, func() bool {
+		got := messages()
+		for topic, payload := range expected {
+			if got[topic] != payload {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond, "expected state on every topic")
+
+	var config discoveryConfig
+	err = json.Unmarshal([]byte(messages()["homeassistant/sensor/solaredge_12345/battery_level/config"]), &config)
+	if assert.NoError(t, err, "battery level should be announced") {
+		assert.Equal(t, "solaredge_12345_battery_level", config.UniqueID)
+		assert.Equal(t, "solaredge/12345/battery_level", config.StateTopic)
+		assert.Equal(t, "solaredge/status", config.AvailabilityTopic)
+		assert.Equal(t, "%", config.UnitOfMeasurement)
+		assert.Equal(t, "battery", config.DeviceClass)
+	}
+
+	var statusConfig discoveryConfig
+	err = json.Unmarshal([]byte(messages()["homeassistant/sensor/solaredge_7E1234AB-12/7E1234AB-12_status/config"]), &statusConfig)
+	if assert.NoError(t, err, "inverter status should be announced") {
+		assert.Equal(t, "solaredge_12345", statusConfig.Device.ViaDevice)
+		assert.Empty(t, statusConfig.UnitOfMeasurement)
+	}
+}
+
+func TestSensorsWithoutPowerFlow(t *testing.T) {
+	publisher := NewPublisher(nil, Options{TopicPrefix: DefaultTopicPrefix})
+	sensors := publisher.sensors(&action.SiteSnapshot{
+		SiteID: "12345",
+		Inverters: map[string]*api.Telemetry{
+			"A": {TotalActivePower: 1000},
+			"B": {TotalActivePower: 500},
+		},
+	})
+
+	states := make(map[string]string)
+	for _, s := range sensors {
+		states[s.stateTopic] = s.state
+	}
+	assert.Equal(t, "1500", states["solaredge/12345/current_power"], "current power should add up the inverters")
+	assert.NotContains(t, states, "solaredge/12345/battery_level")
+	assert.NotContains(t, states, "solaredge/12345/today_energy")
+}
@@ -0,0 +1,156 @@
+// Package pvoutput uploads SolarEdge readings to PVOutput.org.
+package pvoutput
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://pvoutput.org"
+
+	addBatchStatusPath = "/service/r2/addbatchstatus.jsp"
+	addOutputPath      = "/service/r2/addoutput.jsp"
+
+	apiKeyHeader   = "X-Pvoutput-Apikey"
+	systemIDHeader = "X-Pvoutput-SystemId"
+
+	// MaxBatchSize is how many statuses go in one addbatchstatus call; donors may send 100.
+	MaxBatchSize = 30
+	// MaxStatusAge is how far back statuses are accepted; donors get 90 days.
+	MaxStatusAge = 14 * 24 * time.Hour
+)
+
+// ErrRateLimited means PVOutput won't take any more requests this hour.
+var ErrRateLimited = errors.New("pvoutput rate limit reached")
+
+type Client struct {
+	client   http.Client
+	baseURL  string
+	apiKey   string
+	systemID string
+}
+
+func NewClient(apiKey, systemID, baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		client:   http.Client{Timeout: time.Minute},
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		apiKey:   apiKey,
+		systemID: systemID,
+	}
+}
+
+// Status is one point of a day's live data. Times are the system's local time; energy is
+// cumulative since local midnight. Anything nil is left for PVOutput to fill in or leave out.
+type Status struct {
+	Time              time.Time
+	EnergyGeneration  *float64
+	PowerGeneration   *float64
+	EnergyConsumption *float64
+	PowerConsumption  *float64
+	Temperature       *float64
+	Voltage           *float64
+}
+
+// Output is the summary of a whole day.
+type Output struct {
+	Date              time.Time
+	EnergyGeneration  float64
+	EnergyConsumption *float64
+	PeakPower         *float64
+	PeakTime          time.Time
+}
+
+func formatValue(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+func (s Status) format() string {
+	fields := []string{
+		s.Time.Format("20060102"),
+		s.Time.Format("15:04"),
+		formatValue(s.EnergyGeneration),
+		formatValue(s.PowerGeneration),
+		formatValue(s.EnergyConsumption),
+		formatValue(s.PowerConsumption),
+		formatValue(s.Temperature),
+		formatValue(s.Voltage),
+	}
+	// trailing empty fields are dropped, as the API docs do.
+	for len(fields) > 2 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return strings.Join(fields, ",")
+}
+
+// AddBatchStatus uploads up to MaxBatchSize statuses; callers split anything longer.
+func (c *Client) AddBatchStatus(statuses []Status) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	formatted := make([]string, len(statuses))
+	for i, s := range statuses {
+		formatted[i] = s.format()
+	}
+
+	return c.post(addBatchStatusPath, url.Values{"data": {strings.Join(formatted, ";")}})
+}
+
+func (c *Client) AddOutput(output Output) error {
+	form := url.Values{
+		"d": {output.Date.Format("20060102")},
+		"g": {strconv.FormatFloat(output.EnergyGeneration, 'f', -1, 64)},
+	}
+	if output.EnergyConsumption != nil {
+		form.Set("c", formatValue(output.EnergyConsumption))
+	}
+	if output.PeakPower != nil {
+		form.Set("pp", formatValue(output.PeakPower))
+		form.Set("pt", output.PeakTime.Format("15:04"))
+	}
+
+	return c.post(addOutputPath, form)
+}
+
+func (c *Client) post(path string, form url.Values) error {
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(apiKeyHeader, c.apiKey)
+	req.Header.Set(systemIDHeader, c.systemID)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach pvoutput: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// PVOutput says 403 for both a bad key and the hourly limit; the message tells them apart.
+	if resp.StatusCode == http.StatusForbidden && strings.Contains(string(body), "Exceeded") {
+		return ErrRateLimited
+	}
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response code %d from pvoutput: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package pvoutput
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+)
+
+const interval = 15 * time.Minute
+
+// intervalStart is the start of the quarter hour t falls in, by its wall clock, so zones with
+// odd offsets still line up with SolarEdge's periods.
+func intervalStart(t time.Time) time.Time {
+	return t.Add(-time.Duration(t.Minute()%15)*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+}
+
+// statusTime is when a status for the period starting at start is reported: its end, except that
+// the last period of a day stays on that day so its cumulative energy isn't mistaken for the next.
+func statusTime(start time.Time) time.Time {
+	end := start.Add(interval)
+	if end.Day() != start.Day() {
+		return end.Add(-time.Minute)
+	}
+	return end
+}
+
+func dayOf(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+// meterValues indexes a power meter by period start; a nil power or missing meter gives nothing.
+func meterValues(power *api.PowerDetails, meterType string) map[int64]float64 {
+	result := make(map[int64]float64)
+	if power == nil {
+		return result
+	}
+	meter := power.Meter(meterType)
+	if meter == nil {
+		return result
+	}
+	for _, v := range meter.Values {
+		if v.Value != nil {
+			result[v.Date.Unix()] = *v.Value
+		}
+	}
+	return result
+}
+
+type telemetryAverage struct {
+	temperature float64
+	voltage     float64
+	count       int
+}
+
+// averageTelemetry averages temperature and AC voltage over every inverter reporting in each
+// period. Readings from a sleeping inverter are all zero, so they're left out.
+func averageTelemetry(telemetry map[string][]api.Telemetry) map[int64]*telemetryAverage {
+	result := make(map[int64]*telemetryAverage)
+	for _, readings := range telemetry {
+		for _, t := range readings {
+			if t.Temperature == 0 && t.L1Data.ACVoltage == 0 {
+				continue
+			}
+			key := intervalStart(t.Date.Time).Unix()
+			average, ok := result[key]
+			if !ok {
+				average = &telemetryAverage{}
+				result[key] = average
+			}
+			average.temperature += t.Temperature
+			average.voltage += t.L1Data.ACVoltage
+			average.count++
+		}
+	}
+	for _, average := range result {
+		average.temperature /= float64(average.count)
+		average.voltage /= float64(average.count)
+	}
+	return result
+}
+
+// Statuses builds a status per quarter hour of energy. Power comes from the Production and
+// Consumption meters in power when there are any, otherwise generation is worked out from the
+// energy. Consumption energy is left to PVOutput to work out from consumption power.
+func Statuses(energy *api.Energy, power *api.PowerDetails, telemetry map[string][]api.Telemetry) []Status {
+	production := meterValues(power, api.MeterProduction)
+	consumption := meterValues(power, api.MeterConsumption)
+	averages := averageTelemetry(telemetry)
+
+	values := make([]api.Value, 0, len(energy.Values))
+	for _, v := range energy.Values {
+		if v.Value != nil {
+			values = append(values, v)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Date.Before(values[j].Date.Time) })
+
+	var result []Status
+	var day time.Time
+	var cumulative float64
+	for _, v := range values {
+		start := v.Date.Time
+		if d := dayOf(start); !d.Equal(day) {
+			day = d
+			cumulative = 0
+		}
+		cumulative += float64(*v.Value)
+
+		status := Status{
+			Time:             statusTime(start),
+			EnergyGeneration: float64Ptr(cumulative),
+		}
+
+		key := start.Unix()
+		if p, ok := production[key]; ok {
+			status.PowerGeneration = float64Ptr(p)
+		} else {
+			status.PowerGeneration = float64Ptr(float64(*v.Value) * float64(time.Hour/interval))
+		}
+		if c, ok := consumption[key]; ok {
+			status.PowerConsumption = float64Ptr(c)
+		}
+		if average, ok := averages[key]; ok {
+			status.Temperature = float64Ptr(average.temperature)
+			status.Voltage = float64Ptr(average.voltage)
+		}
+
+		result = append(result, status)
+	}
+
+	return result
+}
+
+// Outputs sums quarter-hour energy into a summary per day, with peak power and, when there's a
+// consumption meter, consumption. Callers should only upload days they have all of.
+func Outputs(energy *api.Energy, power *api.PowerDetails) []Output {
+	days := make(map[int64]*Output)
+	var order []int64
+
+	for _, v := range energy.Values {
+		if v.Value == nil {
+			continue
+		}
+		day := dayOf(v.Date.Time)
+		key := day.Unix()
+		output, ok := days[key]
+		if !ok {
+			output = &Output{Date: day}
+			days[key] = output
+			order = append(order, key)
+		}
+		output.EnergyGeneration += float64(*v.Value)
+	}
+
+	if power != nil {
+		if meter := power.Meter(api.MeterProduction); meter != nil {
+			for _, v := range meter.Values {
+				output, ok := days[dayOf(v.Date.Time).Unix()]
+				if !ok || v.Value == nil {
+					continue
+				}
+				if output.PeakPower == nil || *v.Value > *output.PeakPower {
+					output.PeakPower = float64Ptr(*v.Value)
+					output.PeakTime = v.Date.Time
+				}
+			}
+		}
+		if meter := power.Meter(api.MeterConsumption); meter != nil {
+			for _, v := range meter.Values {
+				output, ok := days[dayOf(v.Date.Time).Unix()]
+				if !ok || v.Value == nil {
+					continue
+				}
+				if output.EnergyConsumption == nil {
+					output.EnergyConsumption = float64Ptr(0)
+				}
+				*output.EnergyConsumption += *v.Value * interval.Hours()
+			}
+		}
+	}
+
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+	result := make([]Output, len(order))
+	for i, key := range order {
+		result[i] = *days[key]
+	}
+	return result
+}
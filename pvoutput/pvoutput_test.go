@@ -0,0 +1,166 @@
+package pvoutput
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/stretchr/testify/assert"
+)
+
+var sydney, _ = time.LoadLocation("Australia/Sydney")
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+// quarterHours makes quarter-hour energy from start, one value per entry.
+func quarterHours(start time.Time, values ...int64) *api.Energy {
+	energy := &api.Energy{TimeUnit: api.TimeUnitQuarterHour, Unit: "Wh"}
+	for i, v := range values {
+		energy.Values = append(energy.Values, api.Value{
+			Date:  api.Timestamp{Time: start.Add(time.Duration(i) * interval)},
+			Value: int64Ptr(v),
+		})
+	}
+	return energy
+}
+
+func TestStatuses(t *testing.T) {
+	start := time.Date(2021, 11, 1, 23, 30, 0, 0, sydney)
+	energy := quarterHours(start, 100, 200, 50)
+	energy.Values = append(energy.Values, api.Value{Date: api.Timestamp{Time: start.Add(3 * interval)}})
+
+	consumption := 800.0
+	power := &api.PowerDetails{
+		Meters: []api.PowerMeter{
+			{Type: api.MeterConsumption, Values: []api.PowerValue{{Date: api.Timestamp{Time: start}, Value: &consumption}}},
+		},
+	}
+	telemetry := map[string][]api.Telemetry{
+		"A": {{Date: api.Timestamp{Time: start.Add(5 * time.Minute)}, Temperature: 30, L1Data: api.L1Data{ACVoltage: 240}}},
+		"B": {
+			{Date: api.Timestamp{Time: start.Add(10 * time.Minute)}, Temperature: 40, L1Data: api.L1Data{ACVoltage: 244}},
+			{Date: api.Timestamp{Time: start.Add(20 * time.Minute)}},
+		},
+	}
+
+	statuses := Statuses(energy, power, telemetry)
+	if !assert.Len(t, statuses, 3, "periods without energy shouldn't make statuses") {
+		return
+	}
+
+	assert.Equal(t, "20211101,23:45,100,400,,800,35,242", statuses[0].format())
+	assert.Equal(t, "20211101,23:59,300,800", statuses[1].format(), "the last period of a day should stay on that day")
+	assert.Equal(t, "20211102,00:15,50,200", statuses[2].format(), "energy should start again from zero each day")
+}
+
+func TestOutputs(t *testing.T) {
+	day := time.Date(2021, 11, 1, 0, 0, 0, 0, sydney)
+	energy := quarterHours(day.Add(12*time.Hour), 300, 400)
+	energy.Values = append(energy.Values, quarterHours(day.Add(36*time.Hour), 500).Values...)
+
+	peak, other, consumption := 2000.0, 1500.0, 1000.0
+	power := &api.PowerDetails{
+		Meters: []api.PowerMeter{
+			{Type: api.MeterProduction, Values: []api.PowerValue{
+				{Date: api.Timestamp{Time: day.Add(12 * time.Hour)}, Value: &other},
+				{Date: api.Timestamp{Time: day.Add(12*time.Hour + interval)}, Value: &peak},
+			}},
+			{Type: api.MeterConsumption, Values: []api.PowerValue{
+				{Date: api.Timestamp{Time: day.Add(12 * time.Hour)}, Value: &consumption},
+				{Date: api.Timestamp{Time: day.Add(13 * time.Hour)}, Value: &consumption},
+			}},
+		},
+	}
+
+	outputs := Outputs(energy, power)
+	if !assert.Len(t, outputs, 2) {
+		return
+	}
+	assert.True(t, day.Equal(outputs[0].Date))
+	assert.Equal(t, 700.0, outputs[0].EnergyGeneration)
+	if assert.NotNil(t, outputs[0].PeakPower) && assert.NotNil(t, outputs[0].EnergyConsumption) {
+		assert.Equal(t, peak, *outputs[0].PeakPower)
+		assert.Equal(t, "12:15", outputs[0].PeakTime.Format("15:04"))
+		assert.Equal(t, 500.0, *outputs[0].EnergyConsumption)
+	}
+	assert.Equal(t, 500.0, outputs[1].EnergyGeneration)
+	assert.Nil(t, outputs[1].EnergyConsumption)
+}
+
+func TestUploader(t *testing.T) {
+	var batches []string
+	var outputs []string
+	limited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(apiKeyHeader) != "pv-key" || r.Header.Get(systemIDHeader) != "4242" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if limited {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Forbidden 403: Exceeded 60 requests per hour"))
+			return
+		}
+		r.ParseForm()
+		switch r.URL.Path {
+		case addBatchStatusPath:
+			batches = append(batches, r.PostForm.Get("data"))
+		case addOutputPath:
+			outputs = append(outputs, r.PostForm.Get("d")+" "+r.PostForm.Get("g"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	state, err := LoadState(statePath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	uploader := &Uploader{
+		Client:    NewClient("pv-key", "4242", server.URL),
+		State:     state,
+		SystemID:  "4242",
+		BatchSize: 4,
+	}
+
+	day := time.Date(2021, 11, 1, 0, 0, 0, 0, sydney)
+	statuses := Statuses(quarterHours(day.Add(8*time.Hour), 1, 2, 3, 4, 5, 6), nil, nil)
+
+	uploaded, err := uploader.UploadStatuses(statuses[:5])
+	assert.NoError(t, err)
+	assert.Equal(t, 5, uploaded)
+	if assert.Len(t, batches, 2, "statuses should be split into batches") {
+		assert.Equal(t, 4, strings.Count(batches[0], ";")+1)
+		assert.Equal(t, "20211101,09:15,15,20", batches[1])
+	}
+
+	state, err = LoadState(statePath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	uploader.State = state
+	assert.True(t, statuses[4].Time.Equal(state.Progress("4242").LastStatus), "progress should be saved")
+
+	uploaded, err = uploader.UploadStatuses(statuses)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, uploaded, "only statuses after the last upload should be sent")
+
+	outputList := []Output{{Date: day, EnergyGeneration: 21}, {Date: day.Add(24 * time.Hour), EnergyGeneration: 5}}
+	uploaded, err = uploader.UploadOutputs(outputList, day.Add(24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, uploaded, "today's output shouldn't be sent before the day is over")
+	assert.Equal(t, []string{"20211101 21"}, outputs)
+
+	limited = true
+	uploaded, err = uploader.UploadOutputs(outputList, day.Add(48*time.Hour))
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, 0, uploaded)
+}
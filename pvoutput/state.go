@@ -0,0 +1,160 @@
+package pvoutput
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// State remembers what's been uploaded to each PVOutput system, so runs pick up where the last
+// one stopped.
+type State struct {
+	Systems map[string]*Progress `json:"systems"`
+
+	path string
+}
+
+type Progress struct {
+	SiteID string `json:"siteId"`
+	// LastStatus is the time of the latest status uploaded.
+	LastStatus time.Time `json:"lastStatus"`
+	// LastOutput is the latest day whose output was uploaded.
+	LastOutput time.Time `json:"lastOutput"`
+}
+
+// LoadState reads the state file at path; a missing file is an empty state.
+func LoadState(path string) (*State, error) {
+	state := &State{Systems: make(map[string]*Progress), path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read pvoutput state %s: %w", path, err)
+	}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse pvoutput state %s: %w", path, err)
+	}
+	if state.Systems == nil {
+		state.Systems = make(map[string]*Progress)
+	}
+	return state, nil
+}
+
+// Progress is how far uploads to a system have got, created if there's been none yet.
+func (s *State) Progress(systemID string) *Progress {
+	progress, ok := s.Systems[systemID]
+	if !ok {
+		progress = &Progress{}
+		s.Systems[systemID] = progress
+	}
+	return progress
+}
+
+// Save writes the state through a temporary file, so an interrupted save can't lose it.
+func (s *State) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to save pvoutput state %s: %w", s.path, err)
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to save pvoutput state %s: %w", s.path, err)
+	}
+	return os.Rename(temp.Name(), s.path)
+}
+
+// Uploader sends statuses and outputs a system hasn't had yet, saving progress after every call.
+type Uploader struct {
+	Client    *Client
+	State     *State
+	SystemID  string
+	BatchSize int
+}
+
+// UploadStatuses uploads every status after the last one uploaded, in batches, and returns how
+// many went. On ErrRateLimited what was uploaded is saved, and the next run carries on.
+func (u *Uploader) UploadStatuses(statuses []Status) (int, error) {
+	progress := u.State.Progress(u.SystemID)
+	batchSize := u.BatchSize
+	if batchSize <= 0 {
+		batchSize = MaxBatchSize
+	}
+
+	var pending []Status
+	for _, s := range statuses {
+		if s.Time.After(progress.LastStatus) {
+			pending = append(pending, s)
+		}
+	}
+
+	var uploaded int
+	for len(pending) > 0 {
+		n := batchSize
+		if n > len(pending) {
+			n = len(pending)
+		}
+		batch := pending[:n]
+
+		err := u.Client.AddBatchStatus(batch)
+		if err != nil {
+			return uploaded, err
+		}
+		uploaded += n
+		pending = pending[n:]
+
+		progress.LastStatus = batch[n-1].Time
+		err = u.State.Save()
+		if err != nil {
+			return uploaded, err
+		}
+		log.Debug().Time("until", progress.LastStatus).Int("statuses", n).Msg("uploaded statuses to pvoutput")
+	}
+
+	return uploaded, nil
+}
+
+// UploadOutputs uploads outputs for days after the last one uploaded and before before, which
+// should be the start of the system's today, since a day isn't done until it's over.
+func (u *Uploader) UploadOutputs(outputs []Output, before time.Time) (int, error) {
+	progress := u.State.Progress(u.SystemID)
+
+	var uploaded int
+	for _, output := range outputs {
+		if !output.Date.After(progress.LastOutput) || !output.Date.Before(before) {
+			continue
+		}
+
+		err := u.Client.AddOutput(output)
+		if err != nil {
+			return uploaded, err
+		}
+		uploaded++
+
+		progress.LastOutput = output.Date
+		err = u.State.Save()
+		if err != nil {
+			return uploaded, err
+		}
+	}
+
+	return uploaded, nil
+}
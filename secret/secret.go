@@ -0,0 +1,241 @@
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+const (
+	SchemeEnv            = "env"
+	SchemeFile           = "file"
+	SchemeSecretsManager = "secretsmanager"
+	SchemeSSM            = "ssm"
+)
+
+var schemes = []string{SchemeEnv, SchemeFile, SchemeSecretsManager, SchemeSSM}
+
+// IsReference is whether s names where to find a secret, rather than being one. API keys are
+// letters and digits, so they're never mistaken for one.
+func IsReference(s string) bool {
+	scheme, _, ok := strings.Cut(s, ":")
+	if !ok {
+		return false
+	}
+	if scheme == "arn" {
+		return true
+	}
+	for _, known := range schemes {
+		if scheme == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolver looks secrets up from references like:
+//
+//	env:SOLAREDGE_API_KEY
+//	file:/run/secrets/solaredge-api-key
+//	secretsmanager:solaredge-api-key
+//	secretsmanager:solaredge#apiKey, for a field of a secret holding a JSON object
+//	ssm:/solaredge/api-key
+//
+// Secrets Manager and Parameter Store ARNs work too, with the same #field for secrets. Whatever's
+// found is trimmed of surrounding space, so files can end in a newline.
+type Resolver struct {
+	Getenv   func(string) string
+	ReadFile func(string) ([]byte, error)
+
+	// SecretsManager and SSM are made from the default session when first needed, unless set.
+	SecretsManager secretsmanageriface.SecretsManagerAPI
+	SSM            ssmiface.SSMAPI
+
+	lock sync.Mutex
+	sess *session.Session
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		Getenv:   os.Getenv,
+		ReadFile: ioutil.ReadFile,
+	}
+}
+
+func (r *Resolver) Resolve(ref string) (string, error) {
+	scheme, name, ok := strings.Cut(ref, ":")
+	if !ok {
+		return "", fmt.Errorf("secret reference %q needs a scheme, one of %s", ref, strings.Join(schemes, ", "))
+	}
+
+	var value string
+	var err error
+	switch scheme {
+	case SchemeEnv:
+		value, err = r.env(name)
+	case SchemeFile:
+		value, err = r.file(strings.TrimPrefix(name, "//"))
+	case SchemeSecretsManager:
+		value, err = r.secret(name)
+	case SchemeSSM:
+		value, err = r.parameter(name)
+	case "arn":
+		// arn:partition:service:region:account:resource
+		parts := strings.SplitN(ref, ":", 6)
+		if len(parts) < 6 {
+			return "", fmt.Errorf("secret reference %q isn't a valid ARN", ref)
+		}
+		switch parts[2] {
+		case SchemeSecretsManager:
+			value, err = r.secret(ref)
+		case SchemeSSM:
+			value, err = r.parameter(ref)
+		default:
+			return "", fmt.Errorf("secret reference %q is for %s, not Secrets Manager or Parameter Store", ref, parts[2])
+		}
+	default:
+		return "", fmt.Errorf("unknown secret scheme %q, expected one of %s", scheme, strings.Join(schemes, ", "))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("secret %s is empty", ref)
+	}
+	return value, nil
+}
+
+func (r *Resolver) env(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("env: needs a variable name")
+	}
+	return r.Getenv(name), nil
+}
+
+func (r *Resolver) file(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("file: needs a path")
+	}
+	data, err := r.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret from %s: %w", path, err)
+	}
+	return string(data), nil
+}
+
+// secret reads a secret's current value; with #field, the secret is taken to be a JSON object and
+// the field is read from it.
+func (r *Resolver) secret(ref string) (string, error) {
+	id, field, hasField := strings.Cut(ref, "#")
+	if id == "" {
+		return "", errors.New("secretsmanager: needs a secret ID")
+	}
+
+	client, err := r.secretsManager()
+	if err != nil {
+		return "", err
+	}
+	output, err := client.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch secret %s: %w", id, err)
+	}
+
+	value := aws.StringValue(output.SecretString)
+	if output.SecretString == nil {
+		value = string(output.SecretBinary)
+	}
+	if !hasField {
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal([]byte(value), &fields)
+	if err != nil {
+		return "", fmt.Errorf("secret %s isn't a JSON object, so has no field %s: %w", id, field, err)
+	}
+	v, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %s", id, field)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s field %s isn't a string", id, field)
+	}
+	return s, nil
+}
+
+// parameter reads a Parameter Store parameter, decrypting SecureStrings.
+func (r *Resolver) parameter(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("ssm: needs a parameter name")
+	}
+
+	client, err := r.ssm()
+	if err != nil {
+		return "", err
+	}
+	output, err := client.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch parameter %s: %w", name, err)
+	}
+	if output.Parameter == nil {
+		return "", fmt.Errorf("parameter %s has no value", name)
+	}
+	return aws.StringValue(output.Parameter.Value), nil
+}
+
+func (r *Resolver) secretsManager() (secretsmanageriface.SecretsManagerAPI, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.SecretsManager == nil {
+		sess, err := r.session()
+		if err != nil {
+			return nil, err
+		}
+		r.SecretsManager = secretsmanager.New(sess)
+	}
+	return r.SecretsManager, nil
+}
+
+func (r *Resolver) ssm() (ssmiface.SSMAPI, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.SSM == nil {
+		sess, err := r.session()
+		if err != nil {
+			return nil, err
+		}
+		r.SSM = ssm.New(sess)
+	}
+	return r.SSM, nil
+}
+
+// session is shared between the clients; callers hold the lock.
+func (r *Resolver) session() (*session.Session, error) {
+	if r.sess == nil {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		r.sess = sess
+	}
+	return r.sess, nil
+}
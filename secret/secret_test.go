@@ -0,0 +1,105 @@
+package secret
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	secrets map[string]string
+}
+
+func (f *fakeSecretsManager) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := f.secrets[aws.StringValue(input.SecretId)]
+	if !ok {
+		return nil, errors.New("ResourceNotFoundException")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+type fakeSSM struct {
+	ssmiface.SSMAPI
+	parameters map[string]string
+}
+
+func (f *fakeSSM) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	if !aws.BoolValue(input.WithDecryption) {
+		return nil, errors.New("SecureStrings should be decrypted")
+	}
+	value, ok := f.parameters[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, errors.New("ParameterNotFound")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String(value)}}, nil
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api-key")
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte("FROMFILE\n"), 0600)) {
+		return
+	}
+
+	secretARN := "arn:aws:secretsmanager:us-west-2:123456789012:secret:solaredge-AbCdEf"
+	parameterARN := "arn:aws:ssm:us-west-2:123456789012:parameter/solaredge/api-key"
+	resolver := NewResolver()
+	resolver.Getenv = func(name string) string {
+		return map[string]string{"SOLAREDGE_KEY": " FROMENV "}[name]
+	}
+	resolver.SecretsManager = &fakeSecretsManager{secrets: map[string]string{
+		"solaredge-api-key": "PLAIN",
+		"solaredge":         `{"apiKey": "FIELD", "port": 8080}`,
+		secretARN:           `{"apiKey": "BYARN"}`,
+	}}
+	resolver.SSM = &fakeSSM{parameters: map[string]string{
+		"/solaredge/api-key": "PARAMETER",
+		parameterARN:         "PARAMETERBYARN",
+	}}
+
+	for ref, expected := range map[string]string{
+		"env:SOLAREDGE_KEY":                "FROMENV",
+		"file:" + path:                     "FROMFILE",
+		"file://" + path:                   "FROMFILE",
+		"secretsmanager:solaredge-api-key": "PLAIN",
+		"secretsmanager:solaredge#apiKey":  "FIELD",
+		secretARN + "#apiKey":              "BYARN",
+		"ssm:/solaredge/api-key":           "PARAMETER",
+		parameterARN:                       "PARAMETERBYARN",
+	} {
+		assert.True(t, IsReference(ref), "%s should be a reference", ref)
+		value, err := resolver.Resolve(ref)
+		if assert.NoError(t, err, "unable to resolve %s", ref) {
+			assert.Equal(t, expected, value, "resolving %s", ref)
+		}
+	}
+
+	for _, ref := range []string{
+		"env:MISSING",
+		"env:",
+		"file:" + filepath.Join(dir, "missing"),
+		"secretsmanager:missing",
+		"secretsmanager:solaredge#missing",
+		"secretsmanager:solaredge#port",
+		"secretsmanager:solaredge-api-key#apiKey",
+		"ssm:/missing",
+		"arn:aws:s3:::bucket/key",
+		"vault:solaredge",
+		"solaredge-api-key",
+	} {
+		_, err := resolver.Resolve(ref)
+		assert.Error(t, err, "%s should not resolve", ref)
+	}
+
+	assert.False(t, IsReference("A1B2C3D4E5F6"), "a key shouldn't be taken for a reference")
+	assert.False(t, IsReference("vault:solaredge"))
+}
@@ -0,0 +1,43 @@
+package series
+
+import (
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+)
+
+const MetricEnergy = "energy"
+
+// FromEnergy turns a site's energy readings into a single series. Periods the API has no value
+// for are left out rather than reported as zero.
+func FromEnergy(siteID string, energy *api.Energy) Series {
+	s := Series{
+		Family: FamilyEnergy,
+		Metric: MetricEnergy,
+		Unit:   energy.Unit,
+		SiteID: siteID,
+		Tags: map[string]string{
+			TagTimeUnit: energy.TimeUnit,
+		},
+	}
+	if energy.MeasuredBy != "" {
+		s.Tags[TagMeasuredBy] = energy.MeasuredBy
+	}
+
+	for _, v := range energy.Values {
+		if v.Value == nil {
+			continue
+		}
+		s.Points = append(s.Points, Point{Time: v.Date.Time, Value: float64(*v.Value)})
+	}
+
+	return s
+}
+
+// FromEnergyMap converts what EnergyAction returns, keyed by site ID.
+func FromEnergyMap(energyMap map[string]*api.Energy) []Series {
+	var result []Series
+	for siteID, energy := range energyMap {
+		result = append(result, FromEnergy(siteID, energy))
+	}
+	Sort(result)
+	return result
+}
@@ -0,0 +1,75 @@
+// Package series is the shape every endpoint's readings get flattened into, so that outputs and
+// storage only have to understand one thing.
+package series
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	FamilyEnergy    = "energy"
+	FamilyTelemetry = "telemetry"
+
+	TagTimeUnit     = "timeUnit"
+	TagMeasuredBy   = "measuredBy"
+	TagInverterMode = "inverterMode"
+)
+
+type Series struct {
+	// Family is the endpoint the series came from, e.g. energy or telemetry.
+	Family string `json:"family"`
+	Metric string `json:"metric"`
+	Unit   string `json:"unit,omitempty"`
+	SiteID string `json:"siteId"`
+	// Serial is the device serial number, empty for site-wide series like energy.
+	Serial string            `json:"serial,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	Points []Point           `json:"points"`
+}
+
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	// Tags carries labels that change from reading to reading, like the inverter mode.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// Start and End give the span of times covered by the points, zero if there aren't any.
+func (s *Series) Start() time.Time {
+	var start time.Time
+	for _, p := range s.Points {
+		if start.IsZero() || p.Time.Before(start) {
+			start = p.Time
+		}
+	}
+	return start
+}
+
+func (s *Series) End() time.Time {
+	var end time.Time
+	for _, p := range s.Points {
+		if p.Time.After(end) {
+			end = p.Time
+		}
+	}
+	return end
+}
+
+// Sort puts series in a stable order by site, serial, family and metric; the action results are maps,
+// and output shouldn't shuffle from run to run.
+func Sort(s []Series) {
+	sort.SliceStable(s, func(i, j int) bool {
+		a, b := s[i], s[j]
+		if a.SiteID != b.SiteID {
+			return a.SiteID < b.SiteID
+		}
+		if a.Serial != b.Serial {
+			return a.Serial < b.Serial
+		}
+		if a.Family != b.Family {
+			return a.Family < b.Family
+		}
+		return a.Metric < b.Metric
+	})
+}
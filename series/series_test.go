@@ -0,0 +1,65 @@
+package series
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	energyData = `{"timeUnit":"DAY","unit":"Wh","measuredBy":"INVERTER","values":[
+		{"date":"2021-11-01 00:00:00","value":null},
+		{"date":"2021-11-02 00:00:00","value":1234}]}`
+	telemetryData = `[
+		{"date":"2021-11-23 08:43:41","totalActivePower":2075.03,"dcVoltage":415.7,"inverterMode":"MPPT",
+		 "L1Data":{"acCurrent":8.3504,"acVoltage":248.967}},
+		{"date":"2021-11-23 08:48:41","totalActivePower":2100.5,"dcVoltage":416.1,"inverterMode":"MPPT",
+		 "L1Data":{"acCurrent":8.45,"acVoltage":249.1}}]`
+)
+
+func TestFromEnergy(t *testing.T) {
+	var energy api.Energy
+	if !assert.NoError(t, json.Unmarshal([]byte(energyData), &energy)) {
+		return
+	}
+
+	s := FromEnergy("12345", &energy)
+	assert.Equal(t, FamilyEnergy, s.Family)
+	assert.Equal(t, "Wh", s.Unit)
+	assert.Equal(t, "12345", s.SiteID)
+	assert.Equal(t, api.TimeUnitDay, s.Tags[TagTimeUnit])
+	if assert.Len(t, s.Points, 1, "null values should be skipped") {
+		assert.Equal(t, 1234.0, s.Points[0].Value)
+		assert.True(t, time.Date(2021, 11, 2, 0, 0, 0, 0, time.UTC).Equal(s.Points[0].Time))
+	}
+}
+
+func TestFromTelemetry(t *testing.T) {
+	var telemetries []api.Telemetry
+	if !assert.NoError(t, json.Unmarshal([]byte(telemetryData), &telemetries)) {
+		return
+	}
+
+	result := FromTelemetryMap(map[string]map[string][]api.Telemetry{
+		"12345": {"7E1234AB-12": telemetries},
+	})
+	assert.Len(t, result, len(TelemetryMetrics()))
+
+	byMetric := make(map[string]Series)
+	for _, s := range result {
+		assert.Equal(t, "7E1234AB-12", s.Serial)
+		assert.Len(t, s.Points, 2)
+		byMetric[s.Metric] = s
+	}
+
+	assert.Equal(t, "V", byMetric[MetricDCVoltage].Unit)
+	assert.Equal(t, 416.1, byMetric[MetricDCVoltage].Points[1].Value)
+	assert.Equal(t, 8.45, byMetric[MetricL1ACCurrent].Points[1].Value)
+	assert.Equal(t, "MPPT", byMetric[MetricTotalActivePower].Points[0].Tags[TagInverterMode])
+
+	dc := byMetric[MetricDCVoltage]
+	assert.Equal(t, 5*time.Minute, dc.End().Sub(dc.Start()))
+}
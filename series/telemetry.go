@@ -0,0 +1,112 @@
+package series
+
+import (
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+)
+
+const (
+	MetricTotalActivePower      = "total_active_power"
+	MetricDCVoltage             = "dc_voltage"
+	MetricGroundFaultResistance = "ground_fault_resistance"
+	MetricPowerLimit            = "power_limit"
+	MetricTotalEnergy           = "total_energy"
+	MetricTemperature           = "temperature"
+	MetricOperationMode         = "operation_mode"
+
+	MetricL1ACCurrent     = "l1_ac_current"
+	MetricL1ACVoltage     = "l1_ac_voltage"
+	MetricL1ACFrequency   = "l1_ac_frequency"
+	MetricL1ApparentPower = "l1_apparent_power"
+	MetricL1ActivePower   = "l1_active_power"
+	MetricL1ReactivePower = "l1_reactive_power"
+	MetricL1CosPhi        = "l1_cos_phi"
+)
+
+type telemetryField struct {
+	metric string
+	unit   string
+	value  func(t *api.Telemetry) float64
+}
+
+// telemetryFields lists every numeric reading in api.Telemetry, units per the monitoring API docs.
+var telemetryFields = []telemetryField{
+	{MetricTotalActivePower, "W", func(t *api.Telemetry) float64 { return t.TotalActivePower }},
+	{MetricDCVoltage, "V", func(t *api.Telemetry) float64 { return t.DCVoltage }},
+	{MetricGroundFaultResistance, "kOhm", func(t *api.Telemetry) float64 { return t.GroundFaultResistance }},
+	{MetricPowerLimit, "%", func(t *api.Telemetry) float64 { return t.PowerLimit }},
+	{MetricTotalEnergy, "Wh", func(t *api.Telemetry) float64 { return t.TotalEnergy }},
+	{MetricTemperature, "C", func(t *api.Telemetry) float64 { return t.Temperature }},
+	{MetricOperationMode, "", func(t *api.Telemetry) float64 { return t.OperationMode }},
+
+	{MetricL1ACCurrent, "A", func(t *api.Telemetry) float64 { return t.L1Data.ACCurrent }},
+	{MetricL1ACVoltage, "V", func(t *api.Telemetry) float64 { return t.L1Data.ACVoltage }},
+	{MetricL1ACFrequency, "Hz", func(t *api.Telemetry) float64 { return t.L1Data.ACFrequency }},
+	{MetricL1ApparentPower, "VA", func(t *api.Telemetry) float64 { return t.L1Data.ApparentPower }},
+	{MetricL1ActivePower, "W", func(t *api.Telemetry) float64 { return t.L1Data.ActivePower }},
+	{MetricL1ReactivePower, "VAR", func(t *api.Telemetry) float64 { return t.L1Data.ReactivePower }},
+	{MetricL1CosPhi, "", func(t *api.Telemetry) float64 { return t.L1Data.CosPhi }},
+}
+
+// TelemetryMetrics lists the metric names FromTelemetry produces, in order.
+func TelemetryMetrics() []string {
+	var result []string
+	for _, field := range telemetryFields {
+		result = append(result, field.metric)
+	}
+	return result
+}
+
+// TelemetryUnit gives the unit for one of the TelemetryMetrics.
+func TelemetryUnit(metric string) string {
+	for _, field := range telemetryFields {
+		if field.metric == metric {
+			return field.unit
+		}
+	}
+	return ""
+}
+
+// FromTelemetry turns a device's telemetry into one series per numeric reading. The inverter mode
+// isn't numeric, so it rides along as a tag on each point.
+func FromTelemetry(siteID, serial string, telemetries []api.Telemetry) []Series {
+	result := make([]Series, len(telemetryFields))
+	for i, field := range telemetryFields {
+		result[i] = Series{
+			Family: FamilyTelemetry,
+			Metric: field.metric,
+			Unit:   field.unit,
+			SiteID: siteID,
+			Serial: serial,
+			Points: make([]Point, 0, len(telemetries)),
+		}
+	}
+
+	for i := range telemetries {
+		t := &telemetries[i]
+		var tags map[string]string
+		if t.InverterMode != "" {
+			tags = map[string]string{TagInverterMode: t.InverterMode}
+		}
+		for j, field := range telemetryFields {
+			result[j].Points = append(result[j].Points, Point{
+				Time:  t.Date.Time,
+				Value: field.value(t),
+				Tags:  tags,
+			})
+		}
+	}
+
+	return result
+}
+
+// FromTelemetryMap converts what TelemetryAction returns, keyed by site ID and then serial.
+func FromTelemetryMap(telemetryMap map[string]map[string][]api.Telemetry) []Series {
+	var result []Series
+	for siteID, serials := range telemetryMap {
+		for serial, telemetries := range serials {
+			result = append(result, FromTelemetry(siteID, serial, telemetries)...)
+		}
+	}
+	Sort(result)
+	return result
+}
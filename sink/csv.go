@@ -0,0 +1,370 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
+	"github.com/dreamlibrarian/solaredge-monitoring/storage"
+)
+
+const (
+	ColumnTime         = "time"
+	ColumnSiteID       = "site_id"
+	ColumnSerial       = "serial"
+	ColumnInverterMode = "inverter_mode"
+
+	csvLocationSite = "site"
+)
+
+func init() {
+	Register("csv", func(u *url.URL) (Sink, error) {
+		return newCSVSinkFromURL(u, ',')
+	})
+	Register("tsv", func(u *url.URL) (Sink, error) {
+		return newCSVSinkFromURL(u, '\t')
+	})
+}
+
+// tagColumns maps point tags onto the columns they're written to.
+var tagColumns = map[string]string{
+	ColumnInverterMode: series.TagInverterMode,
+}
+
+type CSVOptions struct {
+	Comma rune
+	// Columns to write, in order. Empty means time, site and serial, then every metric in the batch,
+	// or for a single stream every metric the family can have.
+	Columns []string
+	// Units appends the unit to metric column headers, like "dc_voltage (V)".
+	Units bool
+	// Location to render times in; nil leaves them in the site's own zone.
+	Location *time.Location
+}
+
+// CSVSink writes one row per timestamp, with a column per metric. It either streams everything
+// into one file under a single header, or writes a file per batch into a directory.
+type CSVSink struct {
+	options CSVOptions
+
+	dir storage.Store
+
+	closer io.Closer
+	writer *csv.Writer
+	header []string
+}
+
+// newCSVSinkFromURL reads csv:[path][?columns=a,b&units=false&tz=UTC]. No path means stdout, a
+// path ending in .csv or .tsv means a single file, and anything else is a directory.
+func newCSVSinkFromURL(u *url.URL, comma rune) (Sink, error) {
+	options := CSVOptions{
+		Comma: comma,
+		Units: true,
+	}
+
+	query := u.Query()
+	if columns := query.Get("columns"); columns != "" {
+		options.Columns = strings.Split(columns, ",")
+	}
+	if units := query.Get("units"); units != "" {
+		var err error
+		options.Units, err = strconv.ParseBool(units)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse units=%s: %w", units, err)
+		}
+	}
+	if tz := query.Get("tz"); tz != "" && tz != csvLocationSite {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load time zone %s: %w", tz, err)
+		}
+		options.Location = loc
+	}
+
+	path := Path(u)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case "":
+		if path == "" {
+			return NewCSVSink(os.Stdout, nil, options)
+		}
+		return NewCSVDirectorySink(path, options)
+	case ".csv", ".tsv":
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create directory for %s: %w", path, err)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create %s: %w", path, err)
+		}
+		return NewCSVSink(f, f, options)
+	default:
+		return NewCSVDirectorySink(path, options)
+	}
+}
+
+// NewCSVSink streams every batch into w under one header; closer, if set, is closed along with the sink.
+func NewCSVSink(w io.Writer, closer io.Closer, options CSVOptions) (*CSVSink, error) {
+	if err := validateColumns(options.Columns); err != nil {
+		return nil, err
+	}
+	sink := &CSVSink{
+		options: options,
+		closer:  closer,
+	}
+	sink.writer = sink.newWriter(w)
+	return sink, nil
+}
+
+func NewCSVDirectorySink(dir string, options CSVOptions) (*CSVSink, error) {
+	if err := validateColumns(options.Columns); err != nil {
+		return nil, err
+	}
+	// lean on the directory sink for creating and checking the directory.
+	if _, err := NewDirectorySink(dir); err != nil {
+		return nil, err
+	}
+	return &CSVSink{options: options, dir: storage.NewFileStore(dir)}, nil
+}
+
+func validateColumns(columns []string) error {
+	known := map[string]bool{
+		ColumnTime:          true,
+		ColumnSiteID:        true,
+		ColumnSerial:        true,
+		series.MetricEnergy: true,
+	}
+	for column := range tagColumns {
+		known[column] = true
+	}
+	for _, metric := range series.TelemetryMetrics() {
+		known[metric] = true
+	}
+
+	for _, column := range columns {
+		if !known[column] {
+			return fmt.Errorf("unknown column %s", column)
+		}
+	}
+	return nil
+}
+
+func (c *CSVSink) newWriter(w io.Writer) *csv.Writer {
+	writer := csv.NewWriter(w)
+	if c.options.Comma != 0 {
+		writer.Comma = c.options.Comma
+	}
+	return writer
+}
+
+func (c *CSVSink) extension() string {
+	if c.options.Comma == '\t' {
+		return "tsv"
+	}
+	return "csv"
+}
+
+func (c *CSVSink) Write(batch *Batch) error {
+	if c.dir == nil {
+		if c.header == nil {
+			c.header = c.streamColumns(batch)
+			err := c.writer.Write(c.headerRow(c.header, batch))
+			if err != nil {
+				return err
+			}
+		}
+		if err := c.checkColumns(batch); err != nil {
+			return err
+		}
+		return c.writeRows(c.writer, c.header, batch)
+	}
+
+	var buf bytes.Buffer
+	writer := c.newWriter(&buf)
+	columns := c.columns(batch)
+	err := writer.Write(c.headerRow(columns, batch))
+	if err != nil {
+		return err
+	}
+	err = c.writeRows(writer, columns, batch)
+	if err != nil {
+		return err
+	}
+
+	// the directory holds just the files, without metadata alongside them.
+	return c.dir.Put(BatchPath(batch, c.extension()), buf.Bytes(), storage.PutOptions{})
+}
+
+func (c *CSVSink) Close() error {
+	if c.writer != nil {
+		c.writer.Flush()
+		if err := c.writer.Error(); err != nil {
+			return err
+		}
+	}
+	if c.closer != nil {
+		return c.closer.Close()
+	}
+	return nil
+}
+
+// columns picks the configured columns, or everything the batch has in the order the series
+// package lists metrics.
+func (c *CSVSink) columns(batch *Batch) []string {
+	if len(c.options.Columns) > 0 {
+		return c.options.Columns
+	}
+
+	columns := []string{ColumnTime, ColumnSiteID, ColumnSerial}
+
+	present := make(map[string]bool)
+	hasInverterMode := false
+	for _, s := range batch.Series {
+		present[s.Metric] = true
+		for _, p := range s.Points {
+			if p.Tags[series.TagInverterMode] != "" {
+				hasInverterMode = true
+			}
+		}
+	}
+
+	known := append([]string{series.MetricEnergy}, series.TelemetryMetrics()...)
+	for _, metric := range known {
+		if present[metric] {
+			columns = append(columns, metric)
+			delete(present, metric)
+		}
+	}
+	var others []string
+	for metric := range present {
+		others = append(others, metric)
+	}
+	sort.Strings(others)
+	columns = append(columns, others...)
+
+	if hasInverterMode {
+		columns = append(columns, ColumnInverterMode)
+	}
+
+	return columns
+}
+
+// streamColumns is the header for a single stream, which has to fit every batch to come, not just
+// the first: everything the family can have, unless columns were configured.
+func (c *CSVSink) streamColumns(batch *Batch) []string {
+	if len(c.options.Columns) > 0 {
+		return c.options.Columns
+	}
+	switch batch.Family {
+	case series.FamilyEnergy:
+		return []string{ColumnTime, ColumnSiteID, ColumnSerial, series.MetricEnergy}
+	case series.FamilyTelemetry:
+		columns := append([]string{ColumnTime, ColumnSiteID, ColumnSerial}, series.TelemetryMetrics()...)
+		return append(columns, ColumnInverterMode)
+	default:
+		return c.columns(batch)
+	}
+}
+
+// checkColumns fails a batch with columns the stream's header doesn't have, rather than dropping
+// them. Configured columns are a choice, so anything else is left out of those.
+func (c *CSVSink) checkColumns(batch *Batch) error {
+	if len(c.options.Columns) > 0 {
+		return nil
+	}
+	header := make(map[string]bool, len(c.header))
+	for _, column := range c.header {
+		header[column] = true
+	}
+	for _, column := range c.columns(batch) {
+		if !header[column] {
+			return fmt.Errorf("batch has column %s, which isn't in the header; set the columns, or write to a directory", column)
+		}
+	}
+	return nil
+}
+
+func (c *CSVSink) headerRow(columns []string, batch *Batch) []string {
+	if !c.options.Units {
+		return columns
+	}
+
+	units := make(map[string]string)
+	for _, s := range batch.Series {
+		units[s.Metric] = s.Unit
+	}
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column
+		unit := units[column]
+		if unit == "" {
+			unit = series.TelemetryUnit(column)
+		}
+		if unit != "" {
+			header[i] = fmt.Sprintf("%s (%s)", column, unit)
+		}
+	}
+	return header
+}
+
+func (c *CSVSink) writeRows(writer *csv.Writer, columns []string, batch *Batch) error {
+	rows := make(map[int64]map[string]string)
+	times := make(map[int64]time.Time)
+
+	for _, s := range batch.Series {
+		for _, p := range s.Points {
+			key := p.Time.UnixNano()
+			row, ok := rows[key]
+			if !ok {
+				row = make(map[string]string)
+				rows[key] = row
+				times[key] = p.Time
+			}
+			row[s.Metric] = strconv.FormatFloat(p.Value, 'f', -1, 64)
+			for column, tag := range tagColumns {
+				if value := p.Tags[tag]; value != "" {
+					row[column] = value
+				}
+			}
+		}
+	}
+
+	keys := make([]int64, 0, len(rows))
+	for key := range rows {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	for _, key := range keys {
+		row := rows[key]
+		t := times[key]
+		if c.options.Location != nil {
+			t = t.In(c.options.Location)
+		}
+		row[ColumnTime] = t.Format(time.RFC3339)
+		row[ColumnSiteID] = batch.SiteID
+		row[ColumnSerial] = batch.Serial
+
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		err := writer.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,109 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVSink(t *testing.T) {
+	var buf bytes.Buffer
+	s, err := NewCSVSink(&buf, nil, CSVOptions{Units: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = WriteAll(s, series.FamilyTelemetry, testStart, testEnd, testSeries())
+	if assert.NoError(t, err) && assert.NoError(t, s.Close()) {
+		records, err := csv.NewReader(&buf).ReadAll()
+		if !assert.NoError(t, err) || !assert.Len(t, records, 4, "expected a header and one row per timestamp per device") {
+			return
+		}
+		header := records[0]
+		assert.Len(t, header, 3+len(series.TelemetryMetrics())+1, "a stream's header should fit every telemetry batch, not just the first")
+		assert.Equal(t, []string{"time", "site_id", "serial"}, header[:3])
+		assert.Equal(t, "inverter_mode", header[len(header)-1])
+
+		row := func(record []string) map[string]string {
+			result := make(map[string]string)
+			for i, column := range header {
+				if record[i] != "" {
+					result[column] = record[i]
+				}
+			}
+			return result
+		}
+		assert.Equal(t, map[string]string{"time": "2021-11-23T08:00:00Z", "site_id": "12345", "serial": "7E1234AB-12", "dc_voltage (V)": "415.7", "temperature (C)": "25.8", "inverter_mode": "MPPT"}, row(records[1]))
+		assert.Equal(t, map[string]string{"time": "2021-11-23T08:00:00Z", "site_id": "12345", "serial": "7E5678CD-34", "dc_voltage (V)": "398.2"}, row(records[3]))
+	}
+}
+
+func TestCSVSinkLaterColumns(t *testing.T) {
+	var buf bytes.Buffer
+	s, err := NewCSVSink(&buf, nil, CSVOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	batch := func(metric string) *Batch {
+		return &Batch{Family: "other", SiteID: "12345", Series: []series.Series{
+			{Metric: metric, SiteID: "12345", Points: []series.Point{{Time: testStart, Value: 1}}},
+		}}
+	}
+	assert.NoError(t, s.Write(batch(series.MetricEnergy)))
+	assert.Error(t, s.Write(batch(series.MetricDCVoltage)), "a column the header doesn't have shouldn't be dropped quietly")
+}
+
+func TestCSVSinkOptions(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("tsv://" + dir + "?columns=time,serial,dc_voltage&units=false&tz=America/Los_Angeles")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = WriteAll(s, series.FamilyTelemetry, testStart, testEnd, testSeries())
+	if assert.NoError(t, err) && assert.NoError(t, s.Close()) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "telemetry", "12345", "7E1234AB-12", "20211123T000000Z_20211124T000000Z.tsv"))
+		if assert.NoError(t, err) {
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			assert.Equal(t, "time\tserial\tdc_voltage", lines[0])
+			assert.Equal(t, "2021-11-23T00:00:00-08:00\t7E1234AB-12\t415.7", lines[1])
+		}
+		_, err = os.Stat(filepath.Join(dir, ".meta"))
+		assert.True(t, os.IsNotExist(err), "a directory should only hold the batch files")
+	}
+
+	_, err = Open("csv:?columns=time,bogus")
+	assert.Error(t, err, "unknown columns should be rejected")
+}
+
+func TestCSVSinkSingleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "energy.csv")
+	s, err := Open("csv://" + path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	value := series.Series{
+		Family: series.FamilyEnergy,
+		Metric: series.MetricEnergy,
+		Unit:   "Wh",
+		SiteID: "12345",
+		Points: []series.Point{{Time: testStart.Add(time.Hour), Value: 1234}},
+	}
+	err = WriteAll(s, series.FamilyEnergy, testStart, testEnd, []series.Series{value})
+	if assert.NoError(t, err) && assert.NoError(t, s.Close()) {
+		data, err := ioutil.ReadFile(path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "time,site_id,serial,energy (Wh)\n2021-11-23T01:00:00Z,12345,,1234\n", string(data))
+		}
+	}
+}
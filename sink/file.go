@@ -0,0 +1,105 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/storage"
+)
+
+const fileTimeFormat = "20060102T150405Z0700"
+
+func init() {
+	Register("file", func(u *url.URL) (Sink, error) {
+		return NewDirectorySink(Path(u))
+	})
+	Register("s3", func(u *url.URL) (Sink, error) {
+		store, err := storage.Open(u.String())
+		if err != nil {
+			return nil, err
+		}
+		return NewObjectSink(store), nil
+	})
+}
+
+// ObjectSink writes one JSON object per batch, laid out as <family>/<site>[/<serial>]/<start>_<end>.json
+// in a directory or bucket.
+type ObjectSink struct {
+	store storage.Store
+	// metadata stores content type and batch metadata with each object; directories go without, so
+	// they hold just the batch files.
+	metadata bool
+}
+
+func NewObjectSink(store storage.Store) *ObjectSink {
+	return &ObjectSink{store: store, metadata: true}
+}
+
+// NewDirectorySink writes batches as files under dir, creating it if need be.
+func NewDirectorySink(dir string) (*ObjectSink, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("file output needs a directory")
+	}
+
+	stat, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create output directory %s: %w", dir, err)
+		}
+	} else if err != nil {
+		return nil, err
+	} else if !stat.IsDir() {
+		return nil, fmt.Errorf("path %s must refer to a directory", dir)
+	}
+
+	return &ObjectSink{store: storage.NewFileStore(dir)}, nil
+}
+
+// BatchPath is where a batch lands relative to the directory or bucket prefix, with forward
+// slashes.
+func BatchPath(batch *Batch, extension string) string {
+	parts := []string{batch.Family, batch.SiteID}
+	if batch.Serial != "" {
+		parts = append(parts, batch.Serial)
+	}
+	name := fmt.Sprintf("%s_%s.%s", formatFileTime(batch.Start), formatFileTime(batch.End), extension)
+	return path.Join(append(parts, name)...)
+}
+
+func formatFileTime(t time.Time) string {
+	return t.Format(fileTimeFormat)
+}
+
+// batchMetadata is stored with each object, so it can be found without parsing its key.
+func batchMetadata(batch *Batch) map[string]string {
+	metadata := map[string]string{
+		"family": batch.Family,
+		"site":   batch.SiteID,
+	}
+	if batch.Serial != "" {
+		metadata["serial"] = batch.Serial
+	}
+	return metadata
+}
+
+func (o *ObjectSink) Write(batch *Batch) error {
+	data, err := json.Marshal(batch.Series)
+	if err != nil {
+		return err
+	}
+
+	var options storage.PutOptions
+	if o.metadata {
+		options = storage.PutOptions{ContentType: "application/json", Metadata: batchMetadata(batch)}
+	}
+	return o.store.Put(BatchPath(batch, "json"), data, options)
+}
+
+func (o *ObjectSink) Close() error {
+	return nil
+}
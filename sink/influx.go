@@ -0,0 +1,228 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	influxTokenEnv       = "INFLUX_TOKEN"
+	influxDefaultPath    = "/api/v2/write"
+	influxPrecisionParam = "precision"
+	influxTokenParam     = "token"
+)
+
+func init() {
+	Register("influx", func(u *url.URL) (Sink, error) {
+		w, closer, err := openFileOrStdout(Path(u))
+		if err != nil {
+			return nil, err
+		}
+		return NewInfluxSink(w, closer), nil
+	})
+	Register("influx+http", newInfluxHTTPSinkFromURL)
+	Register("influx+https", newInfluxHTTPSinkFromURL)
+}
+
+// AppendLineProtocol renders a batch as InfluxDB line protocol: a measurement per family, tagged with
+// site, serial and any series or point tags, with a field per metric and nanosecond timestamps.
+func AppendLineProtocol(buf *bytes.Buffer, batch *Batch) {
+	type line struct {
+		time   time.Time
+		tags   map[string]string
+		fields map[string]float64
+	}
+
+	var lines []*line
+	index := make(map[string]*line)
+
+	for _, s := range batch.Series {
+		for _, p := range s.Points {
+			tags := map[string]string{ColumnSiteID: s.SiteID}
+			if s.Serial != "" {
+				tags[ColumnSerial] = s.Serial
+			}
+			for _, t := range []map[string]string{s.Tags, p.Tags} {
+				for k, v := range t {
+					if key, ok := tagKeys[k]; ok {
+						k = key
+					}
+					tags[k] = v
+				}
+			}
+
+			tagSet := formatTagSet(tags)
+			key := strconv.FormatInt(p.Time.UnixNano(), 10) + tagSet
+			l, ok := index[key]
+			if !ok {
+				l = &line{time: p.Time, tags: tags, fields: make(map[string]float64)}
+				index[key] = l
+				lines = append(lines, l)
+			}
+			l.fields[s.Metric] = p.Value
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].time.Before(lines[j].time) })
+
+	for _, l := range lines {
+		buf.WriteString(escapeInflux(batch.Family, ", "))
+		buf.WriteString(formatTagSet(l.tags))
+		buf.WriteByte(' ')
+
+		fieldKeys := make([]string, 0, len(l.fields))
+		for k := range l.fields {
+			fieldKeys = append(fieldKeys, k)
+		}
+		sort.Strings(fieldKeys)
+		for i, k := range fieldKeys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(escapeInflux(k, ",= "))
+			buf.WriteByte('=')
+			buf.WriteString(strconv.FormatFloat(l.fields[k], 'f', -1, 64))
+		}
+
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(l.time.UnixNano(), 10))
+		buf.WriteByte('\n')
+	}
+}
+
+// formatTagSet renders tags sorted by key, which is what Influx prefers, with a leading comma.
+func formatTagSet(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteByte(',')
+		sb.WriteString(escapeInflux(k, ",= "))
+		sb.WriteByte('=')
+		sb.WriteString(escapeInflux(tags[k], ",= "))
+	}
+	return sb.String()
+}
+
+func escapeInflux(s, special string) string {
+	if !strings.ContainsAny(s, special+"\\") {
+		return s
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if r == '\\' || strings.ContainsRune(special, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// InfluxSink writes line protocol to a file or stdout.
+type InfluxSink struct {
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewInfluxSink writes to w; closer, if set, is closed along with the sink.
+func NewInfluxSink(w io.Writer, closer io.Closer) *InfluxSink {
+	return &InfluxSink{w: w, closer: closer}
+}
+
+func (i *InfluxSink) Write(batch *Batch) error {
+	var buf bytes.Buffer
+	AppendLineProtocol(&buf, batch)
+	_, err := i.w.Write(buf.Bytes())
+	return err
+}
+
+func (i *InfluxSink) Close() error {
+	if i.closer != nil {
+		return i.closer.Close()
+	}
+	return nil
+}
+
+// InfluxHTTPSink posts each batch to an Influx write endpoint. The URI is the endpoint with
+// influx+ in front of the scheme, like influx+http://localhost:8086/api/v2/write?org=home&bucket=solar;
+// the token comes from a token parameter or INFLUX_TOKEN.
+type InfluxHTTPSink struct {
+	client   http.Client
+	endpoint string
+	token    string
+}
+
+func newInfluxHTTPSinkFromURL(u *url.URL) (Sink, error) {
+	endpoint := *u
+	endpoint.Scheme = strings.TrimPrefix(u.Scheme, "influx+")
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = influxDefaultPath
+	}
+
+	query := endpoint.Query()
+	token := query.Get(influxTokenParam)
+	query.Del(influxTokenParam)
+	if token == "" {
+		token = os.Getenv(influxTokenEnv)
+	}
+	query.Set(influxPrecisionParam, "ns")
+	endpoint.RawQuery = query.Encode()
+
+	return NewInfluxHTTPSink(endpoint.String(), token), nil
+}
+
+func NewInfluxHTTPSink(endpoint, token string) *InfluxHTTPSink {
+	return &InfluxHTTPSink{
+		client:   http.Client{Timeout: time.Minute},
+		endpoint: endpoint,
+		token:    token,
+	}
+}
+
+func (i *InfluxHTTPSink) Write(batch *Batch) error {
+	var buf bytes.Buffer
+	AppendLineProtocol(&buf, batch)
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, i.endpoint, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.token != "" {
+		req.Header.Set("Authorization", "Token "+i.token)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to write to influx: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response code %d from influx: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (i *InfluxHTTPSink) Close() error {
+	return nil
+}
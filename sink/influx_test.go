@@ -0,0 +1,57 @@
+package sink
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendLineProtocol(t *testing.T) {
+	var buf bytes.Buffer
+	AppendLineProtocol(&buf, &Batch{
+		Family: series.FamilyTelemetry,
+		SiteID: "12345",
+		Serial: "7E1234AB-12",
+		Series: testSeries()[:2],
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "telemetry,inverter_mode=MPPT,serial=7E1234AB-12,site_id=12345 dc_voltage=415.7,temperature=25.8 1637654400000000000", lines[0])
+	}
+
+	assert.Equal(t, `a\ b\,c\=d`, escapeInflux("a b,c=d", ",= "))
+}
+
+func TestInfluxHTTPSink(t *testing.T) {
+	var body, auth, precision string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		auth = r.Header.Get("Authorization")
+		precision = r.URL.Query().Get("precision")
+		assert.Equal(t, "/api/v2/write", r.URL.Path)
+		assert.Equal(t, "solar", r.URL.Query().Get("bucket"))
+		assert.Empty(t, r.URL.Query().Get("token"), "token shouldn't be sent in the query")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	s, err := Open(strings.Replace(server.URL, "http://", "influx+http://", 1) + "?bucket=solar&token=sekrit")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = WriteAll(s, series.FamilyTelemetry, testStart, testEnd, testSeries())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Token sekrit", auth)
+		assert.Equal(t, "ns", precision)
+		assert.True(t, strings.HasPrefix(body, "telemetry,"), "unexpected body %s", body)
+	}
+}
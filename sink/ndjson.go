@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/url"
+	"time"
+)
+
+func init() {
+	Register("ndjson", func(u *url.URL) (Sink, error) {
+		w, closer, err := openFileOrStdout(Path(u))
+		if err != nil {
+			return nil, err
+		}
+		return NewNDJSONSink(w, closer), nil
+	})
+}
+
+// Record is one point with everything needed to make sense of it on its own, for tools like jq,
+// Vector or a Kafka producer that see one line at a time.
+type Record struct {
+	Family    string            `json:"family"`
+	Site      string            `json:"site"`
+	Serial    string            `json:"serial,omitempty"`
+	Metric    string            `json:"metric"`
+	Timestamp time.Time         `json:"timestamp"`
+	Value     float64           `json:"value"`
+	Unit      string            `json:"unit,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// NDJSONSink writes a Record per line, flushing after every batch so a downstream reader sees
+// each site or device as soon as it's fetched.
+type NDJSONSink struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+	closer  io.Closer
+}
+
+// NewNDJSONSink writes to w; closer, if set, is closed along with the sink.
+func NewNDJSONSink(w io.Writer, closer io.Closer) *NDJSONSink {
+	buffered := bufio.NewWriter(w)
+	return &NDJSONSink{
+		w:       buffered,
+		encoder: json.NewEncoder(buffered),
+		closer:  closer,
+	}
+}
+
+func (n *NDJSONSink) Write(batch *Batch) error {
+	for _, s := range batch.Series {
+		for _, p := range s.Points {
+			record := Record{
+				Family:    batch.Family,
+				Site:      s.SiteID,
+				Serial:    s.Serial,
+				Metric:    s.Metric,
+				Timestamp: p.Time,
+				Value:     p.Value,
+				Unit:      s.Unit,
+			}
+			if len(s.Tags)+len(p.Tags) > 0 {
+				record.Tags = make(map[string]string, len(s.Tags)+len(p.Tags))
+				for _, t := range []map[string]string{s.Tags, p.Tags} {
+					for k, v := range t {
+						if key, ok := tagKeys[k]; ok {
+							k = key
+						}
+						record.Tags[k] = v
+					}
+				}
+			}
+
+			err := n.encoder.Encode(record)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return n.w.Flush()
+}
+
+func (n *NDJSONSink) Close() error {
+	err := n.w.Flush()
+	if n.closer != nil {
+		if closeErr := n.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNDJSONSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewNDJSONSink(&buf, nil)
+
+	err := s.Write(&Batch{
+		Family: series.FamilyTelemetry,
+		SiteID: "12345",
+		Serial: "7E1234AB-12",
+		Series: testSeries()[:2],
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 4, "each point should be flushed as a line of its own once the batch is written")
+
+	var record Record
+	if assert.NoError(t, json.Unmarshal([]byte(lines[0]), &record)) {
+		assert.Equal(t, "12345", record.Site)
+		assert.Equal(t, "7E1234AB-12", record.Serial)
+		assert.Equal(t, series.MetricDCVoltage, record.Metric)
+		assert.Equal(t, 415.7, record.Value)
+		assert.Equal(t, "V", record.Unit)
+		assert.True(t, testStart.Add(8*time.Hour).Equal(record.Timestamp))
+		assert.Equal(t, map[string]string{ColumnInverterMode: "MPPT"}, record.Tags)
+	}
+
+	// before Close, whatever's been written should only be whole records.
+	assert.True(t, strings.HasSuffix(buf.String(), "\n"), "the last record should be finished")
+	for _, line := range lines {
+		assert.NoError(t, json.Unmarshal([]byte(line), &Record{}), "%q should be a complete record", line)
+	}
+	assert.NoError(t, s.Close())
+}
+
+func TestNDJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "points.ndjson")
+	s, err := Open("ndjson://" + path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, WriteAll(s, series.FamilyTelemetry, testStart, testEnd, testSeries()))
+	assert.NoError(t, s.Close())
+
+	data, err := ioutil.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, strings.Count(string(data), "\n"))
+	}
+}
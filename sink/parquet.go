@@ -0,0 +1,259 @@
+package sink
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const parquetWriterParallelism = 1
+
+func init() {
+	Register("parquet", func(u *url.URL) (Sink, error) {
+		return NewParquetSink(Path(u))
+	})
+}
+
+// EnergyRow is the Parquet schema for energy, one row per api.Value. Values the API had no reading
+// for never make it into a series, so value is never null.
+type EnergyRow struct {
+	Time       int64  `parquet:"name=time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	SiteID     string `parquet:"name=site_id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	TimeUnit   string `parquet:"name=time_unit, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	MeasuredBy string `parquet:"name=measured_by, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Unit       string `parquet:"name=unit, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Value      int64  `parquet:"name=value, type=INT64"`
+}
+
+// TelemetryRow is the Parquet schema for telemetry, one row per api.Telemetry with L1Data flattened.
+type TelemetryRow struct {
+	Time                  int64   `parquet:"name=time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	SiteID                string  `parquet:"name=site_id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Serial                string  `parquet:"name=serial, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	InverterMode          string  `parquet:"name=inverter_mode, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	TotalActivePower      float64 `parquet:"name=total_active_power, type=DOUBLE"`
+	DCVoltage             float64 `parquet:"name=dc_voltage, type=DOUBLE"`
+	GroundFaultResistance float64 `parquet:"name=ground_fault_resistance, type=DOUBLE"`
+	PowerLimit            float64 `parquet:"name=power_limit, type=DOUBLE"`
+	TotalEnergy           float64 `parquet:"name=total_energy, type=DOUBLE"`
+	Temperature           float64 `parquet:"name=temperature, type=DOUBLE"`
+	OperationMode         float64 `parquet:"name=operation_mode, type=DOUBLE"`
+	L1ACCurrent           float64 `parquet:"name=l1_ac_current, type=DOUBLE"`
+	L1ACVoltage           float64 `parquet:"name=l1_ac_voltage, type=DOUBLE"`
+	L1ACFrequency         float64 `parquet:"name=l1_ac_frequency, type=DOUBLE"`
+	L1ApparentPower       float64 `parquet:"name=l1_apparent_power, type=DOUBLE"`
+	L1ActivePower         float64 `parquet:"name=l1_active_power, type=DOUBLE"`
+	L1ReactivePower       float64 `parquet:"name=l1_reactive_power, type=DOUBLE"`
+	L1CosPhi              float64 `parquet:"name=l1_cos_phi, type=DOUBLE"`
+}
+
+// telemetryRowFields maps metrics onto TelemetryRow, so pivoting series back into rows stays in step
+// with series.TelemetryMetrics.
+var telemetryRowFields = map[string]func(r *TelemetryRow) *float64{
+	series.MetricTotalActivePower:      func(r *TelemetryRow) *float64 { return &r.TotalActivePower },
+	series.MetricDCVoltage:             func(r *TelemetryRow) *float64 { return &r.DCVoltage },
+	series.MetricGroundFaultResistance: func(r *TelemetryRow) *float64 { return &r.GroundFaultResistance },
+	series.MetricPowerLimit:            func(r *TelemetryRow) *float64 { return &r.PowerLimit },
+	series.MetricTotalEnergy:           func(r *TelemetryRow) *float64 { return &r.TotalEnergy },
+	series.MetricTemperature:           func(r *TelemetryRow) *float64 { return &r.Temperature },
+	series.MetricOperationMode:         func(r *TelemetryRow) *float64 { return &r.OperationMode },
+	series.MetricL1ACCurrent:           func(r *TelemetryRow) *float64 { return &r.L1ACCurrent },
+	series.MetricL1ACVoltage:           func(r *TelemetryRow) *float64 { return &r.L1ACVoltage },
+	series.MetricL1ACFrequency:         func(r *TelemetryRow) *float64 { return &r.L1ACFrequency },
+	series.MetricL1ApparentPower:       func(r *TelemetryRow) *float64 { return &r.L1ApparentPower },
+	series.MetricL1ActivePower:         func(r *TelemetryRow) *float64 { return &r.L1ActivePower },
+	series.MetricL1ReactivePower:       func(r *TelemetryRow) *float64 { return &r.L1ReactivePower },
+	series.MetricL1CosPhi:              func(r *TelemetryRow) *float64 { return &r.L1CosPhi },
+}
+
+// ParquetSink writes Hive-style partitions that DuckDB and Spark can read directly:
+// <dir>/<family>/site=<id>/device=<serial>/date=<yyyy-mm-dd>/<start>_<end>.parquet, where the date
+// is the site-local day. Each family gets a directory of its own, since energy and telemetry rows
+// have different schemas and a glob over both would mix them; energy, being site-wide, has no
+// device partition.
+type ParquetSink struct {
+	dir string
+}
+
+func NewParquetSink(dir string) (*ParquetSink, error) {
+	if _, err := NewDirectorySink(dir); err != nil {
+		return nil, err
+	}
+	return &ParquetSink{dir: dir}, nil
+}
+
+func (p *ParquetSink) Write(batch *Batch) error {
+	switch batch.Family {
+	case series.FamilyEnergy:
+		return p.writeEnergy(batch)
+	case series.FamilyTelemetry:
+		return p.writeTelemetry(batch)
+	}
+	return fmt.Errorf("parquet output doesn't know how to write %s", batch.Family)
+}
+
+func (p *ParquetSink) Close() error {
+	return nil
+}
+
+// partitionPath is the directory for one day of a batch.
+func (p *ParquetSink) partitionPath(batch *Batch, date string) string {
+	parts := []string{p.dir, batch.Family, "site=" + batch.SiteID}
+	if batch.Serial != "" {
+		parts = append(parts, "device="+batch.Serial)
+	}
+	parts = append(parts, "date="+date)
+	return filepath.Join(parts...)
+}
+
+func (p *ParquetSink) fileName(batch *Batch) string {
+	return fmt.Sprintf("%s_%s.parquet", formatFileTime(batch.Start), formatFileTime(batch.End))
+}
+
+func (p *ParquetSink) writeEnergy(batch *Batch) error {
+	days := make(map[string][]interface{})
+
+	for _, s := range batch.Series {
+		for _, point := range s.Points {
+			day := point.Time.Format("2006-01-02")
+			days[day] = append(days[day], &EnergyRow{
+				Time:       point.Time.UnixNano() / 1e6,
+				SiteID:     s.SiteID,
+				TimeUnit:   s.Tags[series.TagTimeUnit],
+				MeasuredBy: s.Tags[series.TagMeasuredBy],
+				Unit:       s.Unit,
+				Value:      int64(point.Value),
+			})
+		}
+	}
+
+	for day, rows := range days {
+		err := p.writeFile(p.partitionPath(batch, day), p.fileName(batch), new(EnergyRow), rows)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ParquetSink) writeTelemetry(batch *Batch) error {
+	times, rows, err := pivotTelemetry(batch)
+	if err != nil {
+		return err
+	}
+
+	days := make(map[string][]interface{})
+	for i, row := range rows {
+		day := times[i].Format("2006-01-02")
+		days[day] = append(days[day], row)
+	}
+
+	for day, dayRows := range days {
+		err := p.writeFile(p.partitionPath(batch, day), p.fileName(batch), new(TelemetryRow), dayRows)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pivotTelemetry turns a telemetry batch back into a row per reading, in time order, alongside the
+// time of each row in the site's zone.
+func pivotTelemetry(batch *Batch) ([]time.Time, []*TelemetryRow, error) {
+	rows := make(map[int64]*TelemetryRow)
+	rowTimes := make(map[int64]time.Time)
+
+	for _, s := range batch.Series {
+		field, ok := telemetryRowFields[s.Metric]
+		if !ok {
+			return nil, nil, fmt.Errorf("telemetry schema has no column for %s", s.Metric)
+		}
+		for _, point := range s.Points {
+			key := point.Time.UnixNano()
+			row, ok := rows[key]
+			if !ok {
+				row = &TelemetryRow{
+					Time:   key / 1e6,
+					SiteID: batch.SiteID,
+					Serial: batch.Serial,
+				}
+				rows[key] = row
+				rowTimes[key] = point.Time
+			}
+			*field(row) = point.Value
+			if mode := point.Tags[series.TagInverterMode]; mode != "" {
+				row.InverterMode = mode
+			}
+		}
+	}
+
+	keys := make([]int64, 0, len(rows))
+	for key := range rows {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	times := make([]time.Time, len(keys))
+	result := make([]*TelemetryRow, len(keys))
+	for i, key := range keys {
+		times[i] = rowTimes[key]
+		result[i] = rows[key]
+	}
+	return times, result, nil
+}
+
+// writeFile writes rows to a temporary file next to name and renames it into place once it's
+// complete, like storage.FileStore, so a failure never leaves a truncated file in the partition for
+// query engines to choke on.
+func (p *ParquetSink) writeFile(dir, name string, schema interface{}, rows []interface{}) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create partition %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, name)
+	f, err := ioutil.TempFile(dir, name+".*")
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", path, err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	pw, err := writer.NewParquetWriterFromWriter(f, schema, parquetWriterParallelism)
+	if err != nil {
+		return fmt.Errorf("unable to set up parquet writer for %s: %w", path, err)
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for _, row := range rows {
+		err = pw.Write(row)
+		if err != nil {
+			return fmt.Errorf("unable to write row to %s: %w", path, err)
+		}
+	}
+
+	err = pw.WriteStop()
+	if err != nil {
+		return fmt.Errorf("unable to finish %s: %w", path, err)
+	}
+
+	err = f.Close()
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+	return nil
+}
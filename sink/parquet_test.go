@@ -0,0 +1,118 @@
+package sink
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// parquetFile is just enough of source.ParquetFile to read back what the sink wrote.
+type parquetFile struct {
+	*os.File
+}
+
+func (f parquetFile) Open(name string) (source.ParquetFile, error) {
+	if name == "" {
+		name = f.Name()
+	}
+	file, err := os.Open(name)
+	return parquetFile{file}, err
+}
+
+func (f parquetFile) Create(name string) (source.ParquetFile, error) {
+	file, err := os.Create(name)
+	return parquetFile{file}, err
+}
+
+func TestParquetSink(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("parquet://" + dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = WriteAll(s, series.FamilyTelemetry, testStart, testEnd, testSeries())
+	if !assert.NoError(t, err) || !assert.NoError(t, s.Close()) {
+		return
+	}
+
+	path := filepath.Join(dir, "telemetry", "site=12345", "device=7E1234AB-12", "date=2021-11-23", "20211123T000000Z_20211124T000000Z.parquet")
+	f, err := os.Open(path)
+	if !assert.NoError(t, err, "partition file was not written") {
+		return
+	}
+	defer f.Close()
+
+	pr, err := reader.NewParquetReader(parquetFile{f}, new(TelemetryRow), 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pr.ReadStop()
+
+	rows := make([]TelemetryRow, pr.GetNumRows())
+	if assert.NoError(t, pr.Read(&rows)) && assert.Len(t, rows, 2) {
+		assert.Equal(t, testStart.Add(8*time.Hour).UnixNano()/1e6, rows[0].Time)
+		assert.Equal(t, "7E1234AB-12", rows[0].Serial)
+		assert.Equal(t, "MPPT", rows[0].InverterMode)
+		assert.Equal(t, 415.7, rows[0].DCVoltage)
+		assert.Equal(t, 27.1, rows[1].Temperature)
+	}
+}
+
+func TestParquetSinkEnergy(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewParquetSink(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	energy := series.Series{
+		SiteID: "12345",
+		Metric: series.MetricEnergy,
+		Unit:   "Wh",
+		Points: []series.Point{{Time: testStart.Add(time.Hour), Value: 1234}},
+	}
+	partition := filepath.Join(dir, "energy", "site=12345", "date=2021-11-23")
+	name := "20211123T000000Z_20211124T000000Z.parquet"
+
+	// a directory in the way of the rename fails the write, which shouldn't leave a partial file.
+	if !assert.NoError(t, os.MkdirAll(filepath.Join(partition, name, "x"), 0755)) {
+		return
+	}
+	assert.Error(t, WriteAll(s, series.FamilyEnergy, testStart, testEnd, []series.Series{energy}))
+	entries, err := ioutil.ReadDir(partition)
+	if assert.NoError(t, err) && assert.Len(t, entries, 1, "the temporary file should be cleaned up") {
+		assert.Equal(t, name, entries[0].Name())
+	}
+
+	if !assert.NoError(t, os.RemoveAll(filepath.Join(partition, name))) {
+		return
+	}
+	if !assert.NoError(t, WriteAll(s, series.FamilyEnergy, testStart, testEnd, []series.Series{energy})) {
+		return
+	}
+	f, err := os.Open(filepath.Join(partition, name))
+	if !assert.NoError(t, err, "partition file was not written") {
+		return
+	}
+	defer f.Close()
+
+	pr, err := reader.NewParquetReader(parquetFile{f}, new(EnergyRow), 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pr.ReadStop()
+
+	rows := make([]EnergyRow, pr.GetNumRows())
+	if assert.NoError(t, pr.Read(&rows)) && assert.Len(t, rows, 1) {
+		assert.Equal(t, int64(1234), rows[0].Value)
+		assert.Equal(t, "Wh", rows[0].Unit)
+	}
+}
@@ -0,0 +1,467 @@
+package sink
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
+	"github.com/lib/pq"
+)
+
+func init() {
+	for _, scheme := range []string{"postgres", "postgresql"} {
+		Register(scheme, func(u *url.URL) (Sink, error) {
+			return OpenPostgres(u.String())
+		})
+	}
+}
+
+// postgresMigrations are applied in order, each exactly once, and never edited once released; add
+// a new one instead. Every table with readings keeps time in its primary key, which is what
+// TimescaleDB needs to turn it into a hypertable.
+var postgresMigrations = []string{
+	`CREATE TABLE sites (
+		site_id    TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		time_zone  TEXT NOT NULL,
+		details    JSONB NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	);
+	CREATE TABLE inventory_snapshots (
+		site_id    TEXT NOT NULL,
+		fetched_at TIMESTAMPTZ NOT NULL,
+		inventory  JSONB NOT NULL,
+		PRIMARY KEY (site_id, fetched_at)
+	);
+	CREATE TABLE energy (
+		time        TIMESTAMPTZ NOT NULL,
+		site_id     TEXT NOT NULL,
+		time_unit   TEXT NOT NULL,
+		measured_by TEXT NOT NULL,
+		unit        TEXT NOT NULL,
+		value       DOUBLE PRECISION,
+		PRIMARY KEY (site_id, time_unit, time)
+	);
+	CREATE TABLE telemetry (
+		time                    TIMESTAMPTZ NOT NULL,
+		site_id                 TEXT NOT NULL,
+		serial                  TEXT NOT NULL,
+		inverter_mode           TEXT NOT NULL,
+		total_active_power      DOUBLE PRECISION,
+		dc_voltage              DOUBLE PRECISION,
+		ground_fault_resistance DOUBLE PRECISION,
+		power_limit             DOUBLE PRECISION,
+		total_energy            DOUBLE PRECISION,
+		temperature             DOUBLE PRECISION,
+		operation_mode          DOUBLE PRECISION,
+		l1_ac_current           DOUBLE PRECISION,
+		l1_ac_voltage           DOUBLE PRECISION,
+		l1_ac_frequency         DOUBLE PRECISION,
+		l1_apparent_power       DOUBLE PRECISION,
+		l1_active_power         DOUBLE PRECISION,
+		l1_reactive_power       DOUBLE PRECISION,
+		l1_cos_phi              DOUBLE PRECISION,
+		PRIMARY KEY (site_id, serial, time)
+	);
+	CREATE TABLE sync_state (
+		dataset      TEXT NOT NULL,
+		site_id      TEXT NOT NULL,
+		serial       TEXT NOT NULL,
+		time_unit    TEXT NOT NULL,
+		synced_until TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (dataset, site_id, serial, time_unit)
+	);`,
+	`DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb') THEN
+			PERFORM create_hypertable('energy', 'time', if_not_exists => TRUE, migrate_data => TRUE);
+			PERFORM create_hypertable('telemetry', 'time', if_not_exists => TRUE, migrate_data => TRUE);
+		END IF;
+	END
+	$$;`,
+}
+
+const postgresMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+var (
+	energyTable = postgresTable{
+		name:    "energy",
+		columns: []string{"time", "site_id", "time_unit", "measured_by", "unit", "value"},
+		key:     []string{"site_id", "time_unit", "time"},
+	}
+	telemetryTable = postgresTable{
+		name:    "telemetry",
+		columns: append([]string{"time", "site_id", "serial", "inverter_mode"}, series.TelemetryMetrics()...),
+		key:     []string{"site_id", "serial", "time"},
+	}
+)
+
+type postgresTable struct {
+	name    string
+	columns []string
+	key     []string
+}
+
+// stagingName is the temporary table rows are copied into before they're merged into the table.
+func (t postgresTable) stagingName() string {
+	return t.name + "_staging"
+}
+
+// mergeStatement upserts everything in the staging table into the table. COPY can't resolve
+// conflicts itself, so this is what makes loading the same window twice harmless.
+func (t postgresTable) mergeStatement() string {
+	columns := strings.Join(t.columns, ", ")
+	key := strings.Join(t.key, ", ")
+
+	var updates []string
+	for _, column := range t.columns {
+		if !contains(t.key, column) {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", column, column))
+		}
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT DISTINCT ON (%s) %s FROM %s ORDER BY %s ON CONFLICT (%s) DO UPDATE SET %s",
+		t.name, columns, key, columns, t.stagingName(), key, key, strings.Join(updates, ", "),
+	)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// postgresMigrationLock is the advisory lock every process takes to migrate the schema; it's
+// arbitrary, it just has to stay the same.
+const postgresMigrationLock = 0x536f6c61724564
+
+// PostgresQuerier runs statements, on a connection or in a transaction.
+type PostgresQuerier interface {
+	Exec(query string, args ...interface{}) error
+	// QueryValue scans the first column of the first row into dest, returning false if there are no rows.
+	QueryValue(dest interface{}, query string, args ...interface{}) (bool, error)
+}
+
+// PostgresConn is as much of a Postgres connection as PostgresSink needs, so tests can stand in for
+// a real database.
+type PostgresConn interface {
+	PostgresQuerier
+	// Transaction runs f in a transaction, committing if it returns nil and rolling back otherwise.
+	Transaction(f func(tx PostgresQuerier) error) error
+	// CopyMerge copies rows into a temporary table shaped like table and named staging, then runs
+	// merge, all in one transaction.
+	CopyMerge(table, staging string, columns []string, rows [][]interface{}, merge string) error
+	Close() error
+}
+
+type pqConn struct {
+	db *sql.DB
+}
+
+// NewPQConn connects to Postgres with lib/pq; dsn is a postgres:// URL or key=value connection string.
+func NewPQConn(dsn string) (PostgresConn, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &pqConn{db: db}, nil
+}
+
+func (c *pqConn) Exec(query string, args ...interface{}) error {
+	return pqExec(c.db, query, args...)
+}
+
+func (c *pqConn) QueryValue(dest interface{}, query string, args ...interface{}) (bool, error) {
+	return pqQueryValue(c.db, dest, query, args...)
+}
+
+func (c *pqConn) Transaction(f func(tx PostgresQuerier) error) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = f(&pqTx{tx: tx})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type pqTx struct {
+	tx *sql.Tx
+}
+
+func (t *pqTx) Exec(query string, args ...interface{}) error {
+	return pqExec(t.tx, query, args...)
+}
+
+func (t *pqTx) QueryValue(dest interface{}, query string, args ...interface{}) (bool, error) {
+	return pqQueryValue(t.tx, dest, query, args...)
+}
+
+// pqQueryer is what *sql.DB and *sql.Tx have in common.
+type pqQueryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func pqExec(q pqQueryer, query string, args ...interface{}) error {
+	_, err := q.Exec(query, args...)
+	return err
+}
+
+func pqQueryValue(q pqQueryer, dest interface{}, query string, args ...interface{}) (bool, error) {
+	err := q.QueryRow(query, args...).Scan(dest)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *pqConn) CopyMerge(table, staging string, columns []string, rows [][]interface{}, merge string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(fmt.Sprintf("CREATE TEMPORARY TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP", staging, table))
+	if err != nil {
+		return err
+	}
+
+	statement, err := tx.Prepare(pq.CopyIn(staging, columns...))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		_, err = statement.Exec(row...)
+		if err != nil {
+			statement.Close()
+			return err
+		}
+	}
+	_, err = statement.Exec()
+	if err != nil {
+		statement.Close()
+		return err
+	}
+	err = statement.Close()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(merge)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *pqConn) Close() error {
+	return c.db.Close()
+}
+
+// PostgresSink loads batches into Postgres, or TimescaleDB when the extension is installed, bringing
+// the schema up to date first. It also keeps site details, inventory and sync checkpoints, so sync
+// can use it as its archive.
+type PostgresSink struct {
+	conn PostgresConn
+}
+
+func OpenPostgres(dsn string) (*PostgresSink, error) {
+	conn, err := NewPQConn(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to postgres: %w", err)
+	}
+	p, err := NewPostgresSink(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewPostgresSink applies any migrations conn's database hasn't had yet.
+func NewPostgresSink(conn PostgresConn) (*PostgresSink, error) {
+	p := &PostgresSink{conn: conn}
+	err := p.migrate()
+	if err != nil {
+		return nil, fmt.Errorf("unable to migrate postgres schema: %w", err)
+	}
+	return p, nil
+}
+
+// migrate applies whatever migrations the database hasn't seen, all in one transaction. The
+// advisory lock holds off other processes until it commits, so the version is read after any
+// racing migration has finished, and nothing is applied twice.
+func (p *PostgresSink) migrate() error {
+	return p.conn.Transaction(func(tx PostgresQuerier) error {
+		err := tx.Exec("SELECT pg_advisory_xact_lock($1)", postgresMigrationLock)
+		if err != nil {
+			return err
+		}
+		err = tx.Exec(postgresMigrationsTable)
+		if err != nil {
+			return err
+		}
+
+		var version int
+		_, err = tx.QueryValue(&version, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+		if err != nil {
+			return err
+		}
+
+		for i := version; i < len(postgresMigrations); i++ {
+			err = tx.Exec(fmt.Sprintf("%s\nINSERT INTO schema_migrations (version) VALUES (%d);", postgresMigrations[i], i+1))
+			if err != nil {
+				return fmt.Errorf("migration %d: %w", i+1, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (p *PostgresSink) Write(batch *Batch) error {
+	switch batch.Family {
+	case series.FamilyEnergy:
+		return p.load(energyTable, energyRows(batch))
+	case series.FamilyTelemetry:
+		rows, err := telemetryRows(batch)
+		if err != nil {
+			return err
+		}
+		return p.load(telemetryTable, rows)
+	}
+	return fmt.Errorf("postgres output doesn't know how to write %s", batch.Family)
+}
+
+func (p *PostgresSink) load(table postgresTable, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	err := p.conn.CopyMerge(table.name, table.stagingName(), table.columns, rows, table.mergeStatement())
+	if err != nil {
+		return fmt.Errorf("unable to load %s: %w", table.name, err)
+	}
+	return nil
+}
+
+func energyRows(batch *Batch) [][]interface{} {
+	var rows [][]interface{}
+	for _, s := range batch.Series {
+		for _, point := range s.Points {
+			rows = append(rows, []interface{}{
+				point.Time, s.SiteID, s.Tags[series.TagTimeUnit], s.Tags[series.TagMeasuredBy], s.Unit, point.Value,
+			})
+		}
+	}
+	return rows
+}
+
+func telemetryRows(batch *Batch) ([][]interface{}, error) {
+	times, pivoted, err := pivotTelemetry(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]interface{}, len(pivoted))
+	for i, r := range pivoted {
+		row := []interface{}{times[i], r.SiteID, r.Serial, r.InverterMode}
+		for _, metric := range series.TelemetryMetrics() {
+			row = append(row, *telemetryRowFields[metric](r))
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+func (p *PostgresSink) Close() error {
+	return p.conn.Close()
+}
+
+func (p *PostgresSink) SyncedUntil(dataset, siteID, serial, timeUnit string) (time.Time, error) {
+	var until time.Time
+	_, err := p.conn.QueryValue(&until,
+		`SELECT synced_until FROM sync_state WHERE dataset = $1 AND site_id = $2 AND serial = $3 AND time_unit = $4`,
+		dataset, siteID, serial, timeUnit,
+	)
+	return until, err
+}
+
+func (p *PostgresSink) SetSyncedUntil(dataset, siteID, serial, timeUnit string, until time.Time) error {
+	return p.conn.Exec(
+		`INSERT INTO sync_state (dataset, site_id, serial, time_unit, synced_until) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (dataset, site_id, serial, time_unit) DO UPDATE SET synced_until = excluded.synced_until`,
+		dataset, siteID, serial, timeUnit, until,
+	)
+}
+
+func (p *PostgresSink) PutSite(site *api.SiteDetails) error {
+	details, err := json.Marshal(site)
+	if err != nil {
+		return err
+	}
+	return p.conn.Exec(
+		`INSERT INTO sites (site_id, name, time_zone, details, updated_at) VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (site_id) DO UPDATE SET
+			name = excluded.name, time_zone = excluded.time_zone, details = excluded.details, updated_at = excluded.updated_at`,
+		strconv.FormatInt(site.ID, 10), site.Name, site.Location.TimeZone, string(details),
+	)
+}
+
+// PutInventory only keeps a new snapshot when the inventory has changed since the last one.
+func (p *PostgresSink) PutInventory(siteID string, fetchedAt time.Time, inventory *api.Inventory) error {
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return err
+	}
+	return p.conn.Exec(
+		`INSERT INTO inventory_snapshots (site_id, fetched_at, inventory)
+		SELECT $1, $2, $3::jsonb
+		WHERE NOT EXISTS (
+			SELECT 1 FROM (
+				SELECT inventory FROM inventory_snapshots WHERE site_id = $1 ORDER BY fetched_at DESC LIMIT 1
+			) latest WHERE latest.inventory = $3::jsonb
+		)
+		ON CONFLICT (site_id, fetched_at) DO UPDATE SET inventory = excluded.inventory`,
+		siteID, fetchedAt, string(data),
+	)
+}
+
+func (p *PostgresSink) PutEnergy(siteID string, energy *api.Energy) error {
+	return p.Write(&Batch{
+		Family: series.FamilyEnergy,
+		SiteID: siteID,
+		Series: []series.Series{series.FromEnergy(siteID, energy)},
+	})
+}
+
+func (p *PostgresSink) PutTelemetry(siteID, serial string, telemetries []api.Telemetry) error {
+	return p.Write(&Batch{
+		Family: series.FamilyTelemetry,
+		SiteID: siteID,
+		Serial: serial,
+		Series: series.FromTelemetry(siteID, serial, telemetries),
+	})
+}
@@ -0,0 +1,127 @@
+package sink
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/api"
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
+	"github.com/stretchr/testify/assert"
+)
+
+type copyMerge struct {
+	table   string
+	staging string
+	columns []string
+	rows    [][]interface{}
+	merge   string
+}
+
+// fakePostgres records what the sink asks of the database, and claims to be at a given migration.
+type fakePostgres struct {
+	version      int
+	execs        []string
+	loads        []copyMerge
+	transactions int
+}
+
+func (f *fakePostgres) Exec(query string, args ...interface{}) error {
+	f.execs = append(f.execs, query)
+	return nil
+}
+
+func (f *fakePostgres) QueryValue(dest interface{}, query string, args ...interface{}) (bool, error) {
+	if strings.Contains(query, "schema_migrations") {
+		*dest.(*int) = f.version
+		return true, nil
+	}
+	return false, nil
+}
+
+func (f *fakePostgres) Transaction(fn func(tx PostgresQuerier) error) error {
+	f.transactions++
+	return fn(f)
+}
+
+func (f *fakePostgres) CopyMerge(table, staging string, columns []string, rows [][]interface{}, merge string) error {
+	f.loads = append(f.loads, copyMerge{table, staging, columns, rows, merge})
+	return nil
+}
+
+func (f *fakePostgres) Close() error {
+	return nil
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	conn := &fakePostgres{}
+	_, err := NewPostgresSink(conn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, conn.transactions, "migrations should run in one transaction")
+	if assert.Len(t, conn.execs, 2+len(postgresMigrations)) {
+		assert.Contains(t, conn.execs[0], "pg_advisory_xact_lock", "the lock should be taken before anything else")
+		assert.Contains(t, conn.execs[1], "CREATE TABLE IF NOT EXISTS schema_migrations")
+		assert.Contains(t, conn.execs[2], "CREATE TABLE energy")
+		assert.Contains(t, conn.execs[2], "INSERT INTO schema_migrations (version) VALUES (1)")
+		assert.Contains(t, conn.execs[3], "create_hypertable")
+	}
+
+	conn = &fakePostgres{version: len(postgresMigrations)}
+	_, err = NewPostgresSink(conn)
+	assert.NoError(t, err)
+	assert.Len(t, conn.execs, 2, "an up to date database shouldn't be migrated again")
+}
+
+func TestPostgresWrite(t *testing.T) {
+	conn := &fakePostgres{version: len(postgresMigrations)}
+	p, err := NewPostgresSink(conn)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, WriteAll(p, series.FamilyTelemetry, testStart, testEnd, testSeries()))
+	if !assert.Len(t, conn.loads, 2) {
+		return
+	}
+	load := conn.loads[0]
+	assert.Equal(t, "telemetry", load.table)
+	assert.Equal(t, "telemetry_staging", load.staging)
+	assert.Equal(t, telemetryTable.columns, load.columns)
+	assert.Contains(t, load.merge, "ON CONFLICT (site_id, serial, time) DO UPDATE SET inverter_mode = excluded.inverter_mode")
+	if assert.Len(t, load.rows, 2) {
+		row := load.rows[0]
+		assert.Len(t, row, len(load.columns))
+		assert.True(t, testStart.Add(8*time.Hour).Equal(row[0].(time.Time)))
+		assert.Equal(t, []interface{}{"12345", "7E1234AB-12", "MPPT"}, row[1:4])
+		assert.Equal(t, 415.7, row[4+indexOf(series.TelemetryMetrics(), series.MetricDCVoltage)])
+		assert.Equal(t, 25.8, row[4+indexOf(series.TelemetryMetrics(), series.MetricTemperature)])
+	}
+
+	value := int64(1200)
+	energy := &api.Energy{
+		TimeUnit:   api.TimeUnitDay,
+		Unit:       "Wh",
+		MeasuredBy: "INVERTER",
+		Values: []api.Value{
+			{Date: api.Timestamp{Time: testStart}, Value: &value},
+			{Date: api.Timestamp{Time: testEnd}},
+		},
+	}
+	assert.NoError(t, p.PutEnergy("12345", energy))
+	if assert.Len(t, conn.loads, 3) {
+		load = conn.loads[2]
+		assert.Equal(t, "energy", load.table)
+		assert.Equal(t, [][]interface{}{{testStart, "12345", api.TimeUnitDay, "INVERTER", "Wh", 1200.0}}, load.rows, "missing values shouldn't be loaded")
+	}
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,129 @@
+// Package sink is where commands send the series they've fetched. Sinks are picked by URI, like
+// file:///data or stdout:, so every command writes through the same path.
+package sink
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
+)
+
+// Batch is the series for one site, and one device when Serial is set, over one fetch window.
+type Batch struct {
+	Family string
+	SiteID string
+	Serial string
+	Start  time.Time
+	End    time.Time
+	Series []series.Series
+}
+
+type Sink interface {
+	Write(batch *Batch) error
+	Close() error
+}
+
+// tagKeys renames series and point tags to the snake_case keys used for columns and fields, for
+// sinks that write tags out by name.
+var tagKeys = map[string]string{
+	series.TagTimeUnit:     "time_unit",
+	series.TagMeasuredBy:   "measured_by",
+	series.TagInverterMode: ColumnInverterMode,
+}
+
+// Factory builds a sink from its URI.
+type Factory func(u *url.URL) (Sink, error)
+
+var (
+	factoriesLock sync.Mutex
+	factories     = make(map[string]Factory)
+)
+
+// Register makes a sink available under a URI scheme. It's meant to be called from init.
+func Register(scheme string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	if _, ok := factories[scheme]; ok {
+		panic(fmt.Sprintf("sink scheme %s registered twice", scheme))
+	}
+	factories[scheme] = factory
+}
+
+// Schemes lists the registered URI schemes, for help text.
+func Schemes() []string {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	var result []string
+	for scheme := range factories {
+		result = append(result, scheme)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func Open(uri string) (Sink, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse output %s: %w", uri, err)
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("output %s needs a scheme, one of %s", uri, strings.Join(Schemes(), ", "))
+	}
+
+	factoriesLock.Lock()
+	factory, ok := factories[u.Scheme]
+	factoriesLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown output scheme %s, expected one of %s", u.Scheme, strings.Join(Schemes(), ", "))
+	}
+
+	return factory(u)
+}
+
+// Path pulls a filesystem path out of a URI, accepting file:///abs/path, file:relative/path and
+// file://relative/path alike.
+func Path(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+	return u.Host + u.Path
+}
+
+// WriteAll splits series up into batches per site and device and writes each one.
+func WriteAll(s Sink, family string, start, end time.Time, data []series.Series) error {
+	var batches []*Batch
+	index := make(map[string]*Batch)
+
+	for _, ser := range data {
+		key := ser.SiteID + "/" + ser.Serial
+		batch, ok := index[key]
+		if !ok {
+			batch = &Batch{
+				Family: family,
+				SiteID: ser.SiteID,
+				Serial: ser.Serial,
+				Start:  start,
+				End:    end,
+			}
+			index[key] = batch
+			batches = append(batches, batch)
+		}
+		batch.Series = append(batch.Series, ser)
+	}
+
+	for _, batch := range batches {
+		err := s.Write(batch)
+		if err != nil {
+			return fmt.Errorf("unable to write %s for site %s serial %s: %w", family, batch.SiteID, batch.Serial, err)
+		}
+	}
+
+	return nil
+}
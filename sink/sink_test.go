@@ -0,0 +1,125 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamlibrarian/solaredge-monitoring/series"
+	"github.com/dreamlibrarian/solaredge-monitoring/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testStart = time.Date(2021, 11, 23, 0, 0, 0, 0, time.UTC)
+	testEnd   = testStart.Add(24 * time.Hour)
+)
+
+func testSeries() []series.Series {
+	return []series.Series{
+		{
+			Family: series.FamilyTelemetry,
+			Metric: series.MetricDCVoltage,
+			Unit:   "V",
+			SiteID: "12345",
+			Serial: "7E1234AB-12",
+			Points: []series.Point{
+				{Time: testStart.Add(8 * time.Hour), Value: 415.7, Tags: map[string]string{series.TagInverterMode: "MPPT"}},
+				{Time: testStart.Add(9 * time.Hour), Value: 416.1, Tags: map[string]string{series.TagInverterMode: "MPPT"}},
+			},
+		},
+		{
+			Family: series.FamilyTelemetry,
+			Metric: series.MetricTemperature,
+			Unit:   "C",
+			SiteID: "12345",
+			Serial: "7E1234AB-12",
+			Points: []series.Point{
+				{Time: testStart.Add(8 * time.Hour), Value: 25.8, Tags: map[string]string{series.TagInverterMode: "MPPT"}},
+				{Time: testStart.Add(9 * time.Hour), Value: 27.1, Tags: map[string]string{series.TagInverterMode: "MPPT"}},
+			},
+		},
+		{
+			Family: series.FamilyTelemetry,
+			Metric: series.MetricDCVoltage,
+			Unit:   "V",
+			SiteID: "12345",
+			Serial: "7E5678CD-34",
+			Points: []series.Point{
+				{Time: testStart.Add(8 * time.Hour), Value: 398.2},
+			},
+		},
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, uri := range []string{"file://" + dir, "file:" + dir, "stdout:"} {
+		s, err := Open(uri)
+		if assert.NoError(t, err, "unable to open %s", uri) {
+			assert.NoError(t, s.Close())
+		}
+	}
+
+	for _, uri := range []string{"", dir, "bogus:whatever", "file://"} {
+		_, err := Open(uri)
+		assert.Error(t, err, "should not be able to open %q", uri)
+	}
+}
+
+func TestDirectorySink(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("file://" + dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = WriteAll(s, series.FamilyTelemetry, testStart, testEnd, testSeries())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "telemetry", "12345", "7E1234AB-12", "20211123T000000Z_20211124T000000Z.json"))
+	if assert.NoError(t, err, "batch file was not written") {
+		var written []series.Series
+		if assert.NoError(t, json.Unmarshal(data, &written)) {
+			assert.Len(t, written, 2)
+		}
+	}
+
+	_, err = ioutil.ReadFile(filepath.Join(dir, "telemetry", "12345", "7E5678CD-34", "20211123T000000Z_20211124T000000Z.json"))
+	assert.NoError(t, err, "each device should get its own file")
+
+	_, err = os.Stat(filepath.Join(dir, ".meta"))
+	assert.True(t, os.IsNotExist(err), "a directory should only hold the batch files")
+}
+
+func TestObjectSink(t *testing.T) {
+	store := storage.NewMemoryStore()
+	err := WriteAll(NewObjectSink(store), series.FamilyTelemetry, testStart, testEnd, testSeries())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, object, err := store.Get("telemetry/12345/7E1234AB-12/20211123T000000Z_20211124T000000Z.json")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "application/json", object.ContentType)
+		assert.Equal(t, map[string]string{"family": series.FamilyTelemetry, "site": "12345", "serial": "7E1234AB-12"}, object.Metadata)
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := WriteAll(NewWriterSink(&buf), series.FamilyTelemetry, testStart, testEnd, testSeries())
+	if assert.NoError(t, err) {
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(t, lines, 2, "expected one line per device")
+	}
+}
@@ -0,0 +1,50 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+func init() {
+	Register("stdout", func(u *url.URL) (Sink, error) {
+		return NewWriterSink(os.Stdout), nil
+	})
+}
+
+// WriterSink writes each batch's series as a JSON document on its own line.
+type WriterSink struct {
+	encoder *json.Encoder
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{encoder: json.NewEncoder(w)}
+}
+
+func (w *WriterSink) Write(batch *Batch) error {
+	return w.encoder.Encode(batch.Series)
+}
+
+func (w *WriterSink) Close() error {
+	return nil
+}
+
+// openFileOrStdout is for sinks that write a single stream: an empty path is stdout, which isn't
+// closed, and anything else is a file, created along with its directory.
+func openFileOrStdout(path string) (io.Writer, io.Closer, error) {
+	if path == "" {
+		return os.Stdout, nil, nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create directory for %s: %w", path, err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create %s: %w", path, err)
+	}
+	return f, f, nil
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// metaDir is the hidden directory holding objects' content type and metadata, as a JSON file per
+// object at the same key, so they don't get in the way of anything reading the objects' directory.
+const metaDir = ".meta"
+
+// FileStore keeps objects as files under a directory, with their content type and metadata, when
+// they have any, under .meta.
+type FileStore struct {
+	dir string
+}
+
+type fileMeta struct {
+	ContentType string            `json:"contentType,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+func (f *FileStore) path(key string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(key))
+}
+
+func (f *FileStore) metaPath(key string) string {
+	return filepath.Join(f.dir, metaDir, filepath.FromSlash(key)+".json")
+}
+
+// Put writes through a temporary file, so readers never see half an object.
+func (f *FileStore) Put(key string, data []byte, options PutOptions) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if key == metaDir || strings.HasPrefix(key, metaDir+"/") {
+		return fmt.Errorf("object key %q can't be under %s", key, metaDir)
+	}
+	path := f.path(key)
+	metaPath := f.metaPath(key)
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create directory for %s: %w", path, err)
+	}
+
+	err = writeFile(path, data)
+	if err != nil {
+		return err
+	}
+
+	if options.ContentType == "" && len(options.Metadata) == 0 {
+		err = os.Remove(metaPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to remove stale metadata for %s: %w", path, err)
+		}
+		return nil
+	}
+	meta, err := json.Marshal(fileMeta{ContentType: options.ContentType, Metadata: options.Metadata})
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(metaPath), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create directory for %s: %w", metaPath, err)
+	}
+	return writeFile(metaPath, meta)
+}
+
+func writeFile(path string, data []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func (f *FileStore) Get(key string) ([]byte, *Object, error) {
+	if err := validateKey(key); err != nil {
+		return nil, nil, err
+	}
+	path := f.path(key)
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	object := &Object{Key: key, Size: info.Size(), Modified: info.ModTime()}
+	metaData, err := ioutil.ReadFile(f.metaPath(key))
+	if err == nil {
+		var meta fileMeta
+		if err := json.Unmarshal(metaData, &meta); err != nil {
+			return nil, nil, fmt.Errorf("unable to parse metadata for %s: %w", path, err)
+		}
+		object.ContentType = meta.ContentType
+		object.Metadata = meta.Metadata
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("unable to read metadata for %s: %w", path, err)
+	}
+	return data, object, nil
+}
+
+func (f *FileStore) List(prefix string) ([]Object, error) {
+	var objects []Object
+	err := filepath.WalkDir(f.dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == f.dir {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path == filepath.Join(f.dir, metaDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(f.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list %s: %w", f.dir, err)
+	}
+	sortObjects(objects)
+	return objects, nil
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultLayout is Hive-style, so Athena and Glue can take dataset=<name>/ as a table and the rest
+// as partitions. Segments that refer to something a dataset doesn't have, like serial for energy,
+// are left out.
+const DefaultLayout = "dataset={dataset}/site={site}/serial={serial}/year={year}/month={month}/day={day}"
+
+// objectTimeFormat has no spaces, colons or offsets; names are always in UTC, since S3 event
+// notifications and form-encoded clients read the + of an offset east of UTC as a space. The
+// site-local day is still in the directories.
+const objectTimeFormat = "20060102T150405Z"
+
+var layoutPlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+var layoutFields = map[string]bool{
+	"dataset": true,
+	"site":    true,
+	"serial":  true,
+	"year":    true,
+	"month":   true,
+	"day":     true,
+	"date":    true,
+}
+
+// Partition is what an object holds: a dataset for a site, and device when Serial is set, over a
+// window that doesn't cross midnight in Start's zone; usually the whole day, from DayOf, so every
+// run writes a period to the same object.
+type Partition struct {
+	Dataset string
+	SiteID  string
+	Serial  string
+	Start   time.Time
+	End     time.Time
+}
+
+// Layout turns partitions into object keys, following a template like DefaultLayout with
+// {dataset}, {site}, {serial}, {year}, {month}, {day} and {date} placeholders.
+type Layout struct {
+	segments  []string
+	hasSerial bool
+}
+
+func ParseLayout(template string) (*Layout, error) {
+	template = strings.Trim(template, "/")
+	if template == "" {
+		return nil, fmt.Errorf("layout can't be empty")
+	}
+
+	layout := &Layout{segments: strings.Split(template, "/")}
+	for _, segment := range layout.segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("layout %q has an empty or relative segment", template)
+		}
+		for _, match := range layoutPlaceholder.FindAllStringSubmatch(segment, -1) {
+			if !layoutFields[match[1]] {
+				return nil, fmt.Errorf("layout %q has unknown placeholder %s", template, match[0])
+			}
+			if match[1] == "serial" {
+				layout.hasSerial = true
+			}
+		}
+		if strings.ContainsAny(layoutPlaceholder.ReplaceAllString(segment, ""), "{}") {
+			return nil, fmt.Errorf("layout %q has an unclosed placeholder", template)
+		}
+	}
+	return layout, nil
+}
+
+// Key is where a partition's object goes. The name is the window it covers, in UTC, with the serial
+// in front when the layout doesn't put devices in directories of their own.
+func (l *Layout) Key(p Partition, extension string) string {
+	values := map[string]string{
+		"dataset": p.Dataset,
+		"site":    p.SiteID,
+		"serial":  p.Serial,
+		"year":    p.Start.Format("2006"),
+		"month":   p.Start.Format("01"),
+		"day":     p.Start.Format("02"),
+		"date":    p.Start.Format("2006-01-02"),
+	}
+
+	parts := make([]string, 0, len(l.segments)+1)
+	for _, segment := range l.segments {
+		missing := false
+		part := layoutPlaceholder.ReplaceAllStringFunc(segment, func(placeholder string) string {
+			value := values[strings.Trim(placeholder, "{}")]
+			if value == "" {
+				missing = true
+			}
+			return value
+		})
+		if !missing {
+			parts = append(parts, part)
+		}
+	}
+
+	name := fmt.Sprintf("%s_%s.%s", p.Start.UTC().Format(objectTimeFormat), p.End.UTC().Format(objectTimeFormat), extension)
+	if p.Serial != "" && !l.hasSerial {
+		name = p.Serial + "_" + name
+	}
+	return path.Join(append(parts, name)...)
+}
+
+// DayOf is the whole day t falls in, in t's zone, for partitions that line up from run to run.
+func DayOf(t time.Time) (time.Time, time.Time) {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return start, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayout(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if !assert.NoError(t, err) {
+		return
+	}
+	start := time.Date(2021, 11, 2, 0, 0, 0, 0, la)
+	p := Partition{Dataset: "telemetry", SiteID: "12345", Serial: "7E1234AB-12", Start: start, End: start.Add(6 * time.Hour)}
+
+	layout, err := ParseLayout(DefaultLayout)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "dataset=telemetry/site=12345/serial=7E1234AB-12/year=2021/month=11/day=02/20211102T070000Z_20211102T130000Z.json", layout.Key(p, "json"))
+
+	p.Dataset, p.Serial = "energy", ""
+	assert.Equal(t, "dataset=energy/site=12345/year=2021/month=11/day=02/20211102T070000Z_20211102T130000Z.json", layout.Key(p, "json"), "segments without a value should be left out")
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if assert.NoError(t, err) {
+		start := time.Date(2021, 11, 2, 0, 0, 0, 0, berlin)
+		east := Partition{Dataset: "energy", SiteID: "12345", Start: start, End: start.AddDate(0, 0, 1)}
+		assert.Equal(t, "dataset=energy/site=12345/year=2021/month=11/day=02/20211101T230000Z_20211102T230000Z.json", layout.Key(east, "json"),
+			"names should have no + for sites east of UTC, and the directories the site's own day")
+	}
+
+	layout, err = ParseLayout("/{dataset}/dt={date}/")
+	if !assert.NoError(t, err) {
+		return
+	}
+	p.Dataset, p.Serial = "telemetry", "7E1234AB-12"
+	assert.Equal(t, "telemetry/dt=2021-11-02/7E1234AB-12_20211102T070000Z_20211102T130000Z.json", layout.Key(p, "json"), "the serial should go in the name when the layout has nowhere else for it")
+
+	for _, template := range []string{"", "dataset={dataset}/{hour}", "{dataset}//{site}", "{dataset}/../x", "site={site"} {
+		_, err := ParseLayout(template)
+		assert.Error(t, err, "layout %q should be rejected", template)
+	}
+}
+
+func TestDayOf(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if !assert.NoError(t, err) {
+		return
+	}
+	// 2021-11-07 is 25 hours long in Los Angeles.
+	start, end := DayOf(time.Date(2021, 11, 7, 18, 30, 0, 0, la))
+	assert.True(t, time.Date(2021, 11, 7, 0, 0, 0, 0, la).Equal(start))
+	assert.Equal(t, 25*time.Hour, end.Sub(start))
+	assert.Equal(t, la, start.Location(), "days should be in the site's zone, for partitioning")
+}
+
+func TestPartitionWriter(t *testing.T) {
+	store := NewMemoryStore()
+	layout, err := ParseLayout(DefaultLayout)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	started := time.Date(2021, 11, 2, 12, 0, 0, 0, time.UTC)
+	writer := NewPartitionWriter(store, layout, "energy", "message/1", started)
+
+	empty, err := writer.Finish(started)
+	if assert.NoError(t, err) {
+		assert.Empty(t, empty.Objects)
+	}
+	objects, err := store.List("manifests")
+	assert.NoError(t, err)
+	assert.Empty(t, objects, "a run that wrote nothing shouldn't leave a manifest")
+
+	p := Partition{SiteID: "12345"}
+	p.Start, p.End = DayOf(started)
+	row := func(hour, value int) Row {
+		t := p.Start.Add(time.Duration(hour) * time.Hour)
+		return Row{Time: t, Data: map[string]interface{}{RowTimeField: t.Format(time.RFC3339), "value": value}}
+	}
+	if !assert.NoError(t, writer.WriteRows(p, []Row{row(9, 1), row(8, 1)})) {
+		return
+	}
+	// the 9:00 period was partial; it's replaced by the complete one rather than repeated.
+	if !assert.NoError(t, writer.WriteRows(p, []Row{row(9, 2), row(10, 3)})) {
+		return
+	}
+
+	key := "dataset=energy/site=12345/year=2021/month=11/day=02/20211102T000000Z_20211103T000000Z.json"
+	data, object, err := store.Get(key)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `{"date":"2021-11-02T08:00:00Z","value":1}
+{"date":"2021-11-02T09:00:00Z","value":2}
+{"date":"2021-11-02T10:00:00Z","value":3}
+`, string(data))
+		assert.Equal(t, "application/x-ndjson", object.ContentType)
+	}
+
+	manifest, err := writer.Finish(started.Add(time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, _, err = store.Get("manifests/dataset=energy/message_1.json")
+	if !assert.NoError(t, err, "the manifest should be written where the data partitions won't pick it up") {
+		return
+	}
+	var written Manifest
+	if assert.NoError(t, json.Unmarshal(data, &written)) && assert.Len(t, written.Objects, 1, "an object written twice should be listed once") {
+		entry := written.Objects[0]
+		assert.Equal(t, key, entry.Key)
+		assert.Equal(t, 3, entry.Rows)
+		assert.Equal(t, 126, entry.Bytes)
+		assert.Len(t, entry.SHA256, 64)
+		assert.Equal(t, manifest.Objects[0].SHA256, entry.SHA256)
+		assert.False(t, strings.HasPrefix(entry.Key, manifestPrefix))
+	}
+}
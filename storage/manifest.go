@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestPrefix keeps manifests out of the dataset= directories, so they aren't read as data.
+const manifestPrefix = "manifests"
+
+// Manifest lists what a run wrote, for checking a load is complete before querying it.
+type Manifest struct {
+	RunID      string          `json:"runId"`
+	Dataset    string          `json:"dataset"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt time.Time       `json:"finishedAt"`
+	Objects    []ManifestEntry `json:"objects"`
+}
+
+type ManifestEntry struct {
+	Key    string    `json:"key"`
+	SiteID string    `json:"site"`
+	Serial string    `json:"serial,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Rows   int       `json:"rows"`
+	Bytes  int       `json:"bytes"`
+	SHA256 string    `json:"sha256"`
+}
+
+// PartitionWriter puts objects where a layout says, keeping a manifest of them as it goes.
+type PartitionWriter struct {
+	store  Store
+	layout *Layout
+
+	lock     sync.Mutex
+	manifest Manifest
+}
+
+func NewPartitionWriter(store Store, layout *Layout, dataset, runID string, startedAt time.Time) *PartitionWriter {
+	return &PartitionWriter{
+		store:  store,
+		layout: layout,
+		manifest: Manifest{
+			RunID:     runID,
+			Dataset:   dataset,
+			StartedAt: startedAt,
+			Objects:   []ManifestEntry{},
+		},
+	}
+}
+
+// Row is a line of a partition's object, which must marshal to a JSON object with its time in
+// RowTimeField.
+type Row struct {
+	Time time.Time
+	Data interface{}
+}
+
+// RowTimeField is where rows keep their time, as the API has it.
+const RowTimeField = "date"
+
+// WriteRows merges rows into the partition's object as newline-delimited JSON, which is what
+// Athena's JSON SerDe reads. A row replaces whatever the object had for the same time, so writing
+// the same period again, or a partial period once it's complete, never duplicates it, and writing
+// the same rows again writes the same object. Partitions should be aligned, like whole days, for
+// this to hold across runs; runs writing the same partition at once can lose each other's rows.
+func (w *PartitionWriter) WriteRows(p Partition, rows []Row) error {
+	p.Dataset = w.manifest.Dataset
+	key := w.layout.Key(p, "json")
+
+	merged, err := w.readRows(key)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		line, err := json.Marshal(row.Data)
+		if err != nil {
+			return err
+		}
+		merged[row.Time.UnixNano()] = line
+	}
+
+	times := make([]int64, 0, len(merged))
+	for t := range merged {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	var buf bytes.Buffer
+	for _, t := range times {
+		buf.Write(merged[t])
+		buf.WriteByte('\n')
+	}
+	data := buf.Bytes()
+
+	metadata := map[string]string{"dataset": p.Dataset, "site": p.SiteID}
+	if p.Serial != "" {
+		metadata["serial"] = p.Serial
+	}
+	err = w.store.Put(key, data, PutOptions{ContentType: "application/x-ndjson", Metadata: metadata})
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	entry := ManifestEntry{
+		Key:    key,
+		SiteID: p.SiteID,
+		Serial: p.Serial,
+		Start:  p.Start,
+		End:    p.End,
+		Rows:   len(times),
+		Bytes:  len(data),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for i := range w.manifest.Objects {
+		if w.manifest.Objects[i].Key == key {
+			w.manifest.Objects[i] = entry
+			return nil
+		}
+	}
+	w.manifest.Objects = append(w.manifest.Objects, entry)
+	return nil
+}
+
+// readRows reads an object's rows back by time, or none if it isn't there yet.
+func (w *PartitionWriter) readRows(key string) (map[int64][]byte, error) {
+	rows := make(map[int64][]byte)
+	data, _, err := w.store.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return rows, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		err := json.Unmarshal(line, &fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s has a row that isn't a JSON object: %w", key, err)
+		}
+		var stamp string
+		err = json.Unmarshal(fields[RowTimeField], &stamp)
+		if err != nil {
+			return nil, fmt.Errorf("%s has a row without a %s: %w", key, RowTimeField, err)
+		}
+		t, err := time.Parse(time.RFC3339, stamp)
+		if err != nil {
+			return nil, fmt.Errorf("%s has a row with a bad %s: %w", key, RowTimeField, err)
+		}
+		rows[t.UnixNano()] = append([]byte(nil), line...)
+	}
+	return rows, nil
+}
+
+// Finish writes the manifest to manifests/dataset=<dataset>/<run>.json, unless nothing was
+// written, and returns it. The key is just the run ID, so running the same ID again replaces it.
+func (w *PartitionWriter) Finish(finishedAt time.Time) (*Manifest, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.manifest.FinishedAt = finishedAt
+	if len(w.manifest.Objects) == 0 {
+		return &w.manifest, nil
+	}
+
+	data, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s/dataset=%s/%s.json", manifestPrefix, w.manifest.Dataset, safeName(w.manifest.RunID))
+	err = w.store.Put(key, data, PutOptions{ContentType: "application/json"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to write manifest: %w", err)
+	}
+	return &w.manifest, nil
+}
+
+// safeName keeps run IDs, which may be message IDs or have slashes in them, to one key segment.
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps objects for as long as the process runs, for tests.
+type MemoryStore struct {
+	lock    sync.Mutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data   []byte
+	object Object
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string]memoryObject)}
+}
+
+func (m *MemoryStore) Put(key string, data []byte, options PutOptions) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	metadata := make(map[string]string, len(options.Metadata))
+	for k, v := range options.Metadata {
+		metadata[k] = v
+	}
+	m.objects[key] = memoryObject{
+		data: append([]byte(nil), data...),
+		object: Object{
+			Key:         key,
+			Size:        int64(len(data)),
+			ContentType: options.ContentType,
+			Metadata:    metadata,
+			Modified:    time.Now(),
+		},
+	}
+	return nil
+}
+
+func (m *MemoryStore) Get(key string) ([]byte, *Object, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stored, ok := m.objects[key]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	object := stored.object
+	return append([]byte(nil), stored.data...), &object, nil
+}
+
+func (m *MemoryStore) List(prefix string) ([]Object, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var objects []Object
+	for key, stored := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			object := stored.object
+			object.Metadata = nil
+			objects = append(objects, object)
+		}
+	}
+	sortObjects(objects)
+	return objects, nil
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/rs/zerolog/log"
+)
+
+// S3Store keeps objects in a bucket, under a prefix.
+type S3Store struct {
+	client s3iface.S3API
+	bucket string
+	prefix string
+}
+
+func NewS3Store(client s3iface.S3API, bucket, prefix string) *S3Store {
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+	return &S3Store{client: client, bucket: bucket, prefix: prefix}
+}
+
+// Put skips objects that are already there with the same content, so data fetched twice, like
+// for a redelivered message, isn't written twice.
+func (s *S3Store) Put(key string, data []byte, options PutOptions) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	sum := md5.Sum(data)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	head, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	if err == nil && aws.StringValue(head.ETag) == etag &&
+		aws.StringValue(head.ContentType) == options.ContentType && sameMetadata(head.Metadata, options.Metadata) {
+		log.Debug().Str("key", key).Msg("object is already stored, skipping")
+		return nil
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+		Body:   bytes.NewReader(data),
+	}
+	if options.ContentType != "" {
+		input.ContentType = aws.String(options.ContentType)
+	}
+	if len(options.Metadata) > 0 {
+		input.Metadata = aws.StringMap(options.Metadata)
+	}
+	_, err = s.client.PutObject(input)
+	if err != nil {
+		return fmt.Errorf("unable to store %s: %w", key, err)
+	}
+	return nil
+}
+
+// sameMetadata compares case-insensitively, as S3 hands metadata keys back capitalised.
+func sameMetadata(stored map[string]*string, metadata map[string]string) bool {
+	if len(stored) != len(metadata) {
+		return false
+	}
+	for k, v := range stored {
+		found := false
+		for mk, mv := range metadata {
+			if strings.EqualFold(k, mk) && aws.StringValue(v) == mv {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *S3Store) Get(key string) ([]byte, *Object, error) {
+	if err := validateKey(key); err != nil {
+		return nil, nil, err
+	}
+	output, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, nil, fmt.Errorf("unable to get %s: %w", key, err)
+	}
+	defer output.Body.Close()
+
+	data, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read %s: %w", key, err)
+	}
+	object := &Object{
+		Key:         key,
+		Size:        int64(len(data)),
+		ContentType: aws.StringValue(output.ContentType),
+		Metadata:    aws.StringValueMap(output.Metadata),
+		Modified:    aws.TimeValue(output.LastModified),
+	}
+	return data, object, nil
+}
+
+func (s *S3Store) List(prefix string) ([]Object, error) {
+	var objects []Object
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix + prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range page.Contents {
+			objects = append(objects, Object{
+				Key:      strings.TrimPrefix(aws.StringValue(o.Key), s.prefix),
+				Size:     aws.Int64Value(o.Size),
+				Modified: aws.TimeValue(o.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list %s: %w", prefix, err)
+	}
+	sortObjects(objects)
+	return objects, nil
+}
@@ -0,0 +1,93 @@
+// Package storage is somewhere to put objects: S3 for the Lambda collector, a directory for
+// running the same thing locally, and memory for tests. Keys always use forward slashes.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ErrNotFound is returned by Get for keys that don't exist.
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored object.
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	Metadata    map[string]string
+	Modified    time.Time
+}
+
+// PutOptions are stored alongside an object's data.
+type PutOptions struct {
+	ContentType string
+	Metadata    map[string]string
+}
+
+type Store interface {
+	// Put writes an object, replacing whatever was at key.
+	Put(key string, data []byte, options PutOptions) error
+	// Get reads an object, or fails with ErrNotFound.
+	Get(key string) ([]byte, *Object, error)
+	// List describes every object whose key starts with prefix, sorted by key. Metadata isn't
+	// filled in, as it costs a request per object on S3.
+	List(prefix string) ([]Object, error)
+}
+
+// Open picks a store by URI: s3://bucket/prefix, or a directory, with or without file://.
+func Open(uri string) (Store, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse storage %s: %w", uri, err)
+	}
+
+	switch u.Scheme {
+	case "", "file":
+		dir := u.Path
+		if u.Scheme == "" {
+			dir = uri
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("storage %s needs a directory", uri)
+		}
+		return NewFileStore(dir), nil
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("storage %s needs a bucket", uri)
+		}
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Store(s3.New(sess), u.Host, u.Path), nil
+	default:
+		return nil, fmt.Errorf("storage %s should be s3:// or a directory", uri)
+	}
+}
+
+// validateKey keeps keys inside their store, whichever store it is.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return fmt.Errorf("object key %q must be relative", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("object key %q has an empty or relative part", key)
+		}
+	}
+	return nil
+}
+
+func sortObjects(objects []Object) {
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 keeps objects in a map, capitalising metadata keys like S3 does.
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string]*s3.PutObjectInput
+	data    map[string][]byte
+	puts    int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string]*s3.PutObjectInput{}, data: map[string][]byte{}}
+}
+
+func (f *fakeS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	metadata := map[string]*string{}
+	for k, v := range input.Metadata {
+		metadata[strings.ToUpper(k[:1])+k[1:]] = v
+	}
+	input.Metadata = metadata
+	f.objects[aws.StringValue(input.Key)] = input
+	f.data[aws.StringValue(input.Key)] = data
+	f.puts++
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	object, ok := f.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New("NotFound", "not found", nil)
+	}
+	sum := md5.Sum(f.data[aws.StringValue(input.Key)])
+	return &s3.HeadObjectOutput{
+		ETag:        aws.String(`"` + hex.EncodeToString(sum[:]) + `"`),
+		ContentType: object.ContentType,
+		Metadata:    object.Metadata,
+	}, nil
+}
+
+func (f *fakeS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	object, ok := f.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "no such key", nil)
+	}
+	return &s3.GetObjectOutput{
+		Body:        ioutil.NopCloser(bytes.NewReader(f.data[aws.StringValue(input.Key)])),
+		ContentType: object.ContentType,
+		Metadata:    object.Metadata,
+	}, nil
+}
+
+func (f *fakeS3) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	page := &s3.ListObjectsV2Output{}
+	for key, data := range f.data {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			page.Contents = append(page.Contents, &s3.Object{Key: aws.String(key), Size: aws.Int64(int64(len(data)))})
+		}
+	}
+	fn(page, true)
+	return nil
+}
+
+// testStore puts a store through what the collectors and sinks do with it.
+func testStore(t *testing.T, store Store) {
+	options := PutOptions{ContentType: "application/json", Metadata: map[string]string{"site": "12345"}}
+	assert.NoError(t, store.Put("energy/12345/a.json", []byte(`{"a":1}`), options))
+	assert.NoError(t, store.Put("energy/12345/b.json", []byte(`{"b":2}`), PutOptions{}))
+	assert.NoError(t, store.Put("telemetry/12345/A/c.json", []byte(`{"c":3}`), options))
+
+	data, object, err := store.Get("energy/12345/a.json")
+	if assert.NoError(t, err) {
+		assert.Equal(t, `{"a":1}`, string(data))
+		assert.Equal(t, "application/json", object.ContentType)
+		assert.Equal(t, int64(7), object.Size)
+		for k, v := range object.Metadata {
+			assert.True(t, strings.EqualFold("site", k), "unexpected metadata %s", k)
+			assert.Equal(t, "12345", v)
+		}
+		assert.Len(t, object.Metadata, 1)
+	}
+
+	_, _, err = store.Get("energy/12345/missing.json")
+	assert.True(t, errors.Is(err, ErrNotFound), "missing objects should be ErrNotFound, not %v", err)
+
+	objects, err := store.List("energy/")
+	if assert.NoError(t, err) && assert.Len(t, objects, 2) {
+		assert.Equal(t, "energy/12345/a.json", objects[0].Key)
+		assert.Equal(t, "energy/12345/b.json", objects[1].Key)
+	}
+	objects, err = store.List("")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 3)
+
+	for _, key := range []string{"", "/energy/x.json", "energy/../../x.json", "energy//x.json"} {
+		assert.Error(t, store.Put(key, nil, PutOptions{}), "key %q should be refused", key)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	testStore(t, NewFileStore(dir))
+
+	_, err := os.Stat(filepath.Join(dir, "energy", "12345", "a.json"))
+	assert.NoError(t, err, "objects should be plain files")
+	entries, err := ioutil.ReadDir(filepath.Join(dir, "energy", "12345"))
+	if assert.NoError(t, err) {
+		assert.Len(t, entries, 2, "metadata shouldn't sit next to the objects")
+	}
+
+	objects, err := NewFileStore(filepath.Join(dir, "missing")).List("")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+}
+
+func TestS3Store(t *testing.T) {
+	fake := newFakeS3()
+	store := NewS3Store(fake, "bucket", "/collector/")
+	testStore(t, store)
+	assert.Contains(t, fake.data, "collector/energy/12345/a.json")
+
+	puts := fake.puts
+	options := PutOptions{ContentType: "application/json", Metadata: map[string]string{"site": "12345"}}
+	assert.NoError(t, store.Put("energy/12345/a.json", []byte(`{"a":1}`), options))
+	assert.Equal(t, puts, fake.puts, "an object that's already there shouldn't be written again")
+	assert.NoError(t, store.Put("energy/12345/a.json", []byte(`{"a":2}`), options))
+	assert.Equal(t, puts+1, fake.puts)
+}